@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"github.com/246859/codis/coco"
+	"github.com/246859/codis/config"
+	"github.com/246859/codis/pkg/logger"
+	"github.com/246859/codis/pkg/util/banner"
+	"github.com/246859/codis/pkg/util/osnotify"
+	"github.com/246859/codis/redis"
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/static"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// exit codes
+const (
+	exitOK = iota
+	// server failed while running, e.g. can not listen on the address
+	exitFailure
+	// invalid command line flags or configuration
+	exitUsage
+)
+
+var (
+	bind       string
+	port       int
+	configFile string
+	logLevel   string
+	lenient    bool
+)
+
+// flagKeys maps the flags to the configuration keys they override
+var flagKeys = map[string]string{
+	"bind":     "network.bind",
+	"port":     "network.port",
+	"loglevel": "log.level",
+}
+
+func init() {
+	flag.StringVar(&bind, "bind", "127.0.0.1", "the address to bind")
+	flag.IntVar(&port, "port", 6379, "the port to listen on")
+	flag.StringVar(&configFile, "config", "", "the configuration file, yaml or redis.conf with .conf extension")
+	flag.BoolVar(&lenient, "lenient", false, "ignore unknown directives in redis.conf")
+	flag.StringVar(&logLevel, "loglevel", logger.LevelInfo, "log level: trace, debug, info, warn, error")
+}
+
+// loadConfig loads the configuration file, the flags set explicitly take precedence over it
+func loadConfig() (*config.Config, error) {
+	overrides := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			overrides[key] = f.Value.String()
+		}
+	})
+	return config.Load(configFile, overrides, config.WithLenient(lenient))
+}
+
+func main() {
+	flag.Parse()
+	os.Exit(run())
+}
+
+func run() int {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if err := logger.Setup(cfg.Log); err != nil {
+		fmt.Fprintln(os.Stderr, "setup logger failed:", err)
+		return exitUsage
+	}
+	defer logger.Close()
+
+	banner.PrintlnBannerEmbed(static.StaticFs, "banner.txt")
+
+	server := coco.NewServer(context.Background(),
+		coco.WithConfig(cfg.Network.Config),
+		coco.WithRejectHook(redis.RejectMaxClients),
+	)
+
+	listeners, err := listen(cfg.Network)
+	if err != nil {
+		logger.Error("listen failed: ", err)
+		closeAll(listeners)
+		return exitFailure
+	}
+
+	// graceful shutdown on signals
+	shutdown := make(chan error, 1)
+	osnotify.Signals(os.Interrupt, syscall.SIGTERM).Notify(func(sig os.Signal) {
+		logger.Infof("received signal %s, shutting down", sig)
+		shutdown <- server.Shutdown()
+	})
+
+	handler := redis.NewHandler(cfg.Network.Limits, redis.DefaultRegistry(), database.NewKeyspace(cfg.Databases))
+	for _, group := range listeners {
+		var err error
+		if cfg.Network.EventLoop && eventLoopCapable(cfg.Network, group) {
+			err = server.AddEvents(group, handler)
+		} else {
+			err = server.AddGroup(group, handler)
+		}
+		if err != nil {
+			logger.Error("serve failed: ", err)
+			server.Shutdown()
+			closeAll(listeners)
+			return exitFailure
+		}
+	}
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			logger.Error("shutdown failed: ", err)
+			return exitFailure
+		}
+	case err := <-server.Errors():
+		logger.Error("server stopped unexpectedly: ", err)
+		// stop the other listeners
+		server.Shutdown()
+		return exitFailure
+	}
+
+	logger.Info("server stopped")
+	return exitOK
+}
+
+// listen creates the tcp listeners, and the unix socket and tls listeners if they are configured,
+// the listeners bound to the same address are grouped together.
+func listen(cfg config.Network) ([][]net.Listener, error) {
+	var listeners [][]net.Listener
+
+	address := net.JoinHostPort(cfg.Bind, strconv.Itoa(cfg.Port))
+	var (
+		tcp []net.Listener
+		err error
+	)
+	if cfg.ReusePort > 1 {
+		tcp, err = coco.ListenReusePort("tcp", address, cfg.ReusePort)
+	} else {
+		var lis net.Listener
+		lis, err = net.Listen("tcp", address)
+		tcp = append(tcp, lis)
+	}
+	if err != nil {
+		return listeners, err
+	}
+	// the listeners are replaced in place by the proxy listeners, which close them on Close
+	listeners = append(listeners, tcp)
+
+	if cfg.Proxy.Enabled {
+		for i, lis := range tcp {
+			if tcp[i], err = coco.NewProxyListener(lis, cfg.Proxy); err != nil {
+				return listeners, err
+			}
+		}
+	}
+
+	if cfg.UnixSocket != "" {
+		perm, err := cfg.SocketPerm()
+		if err != nil {
+			return listeners, err
+		}
+		unix, err := coco.ListenUnix(cfg.UnixSocket, perm)
+		if err != nil {
+			return listeners, err
+		}
+		listeners = append(listeners, []net.Listener{unix})
+	}
+
+	if cfg.TLS.Port != 0 {
+		tlsConfig, err := coco.NewTLSConfig(cfg.TLS.TLSConfig)
+		if err != nil {
+			return listeners, err
+		}
+		lis, err := net.Listen("tcp", net.JoinHostPort(cfg.Bind, strconv.Itoa(cfg.TLS.Port)))
+		if err != nil {
+			return listeners, err
+		}
+		listeners = append(listeners, []net.Listener{lis})
+
+		// the PROXY protocol header is sent before the tls handshake
+		if cfg.Proxy.Enabled {
+			if lis, err = coco.NewProxyListener(lis, cfg.Proxy); err != nil {
+				return listeners, err
+			}
+		}
+		listeners[len(listeners)-1][0] = tls.NewListener(lis, tlsConfig)
+	}
+
+	return listeners, nil
+}
+
+// eventLoopCapable reports whether the listeners can be served in event-loop mode, the loops read the sockets
+// directly, so the tls listener and the listeners with PROXY protocol are not capable.
+func eventLoopCapable(cfg config.Network, group []net.Listener) bool {
+	switch addr := group[0].Addr().(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		return !cfg.Proxy.Enabled && (cfg.TLS.Port == 0 || addr.Port != cfg.TLS.Port)
+	}
+	return false
+}
+
+func closeAll(listeners [][]net.Listener) {
+	for _, group := range listeners {
+		for _, lis := range group {
+			lis.Close()
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package coco
+
+import (
+	"errors"
+	"math"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Backoff is the policy of retrying accept on temporary errors, e.g. EMFILE when the file descriptors
+// are exhausted, the delay grows exponentially with the consecutive failures and is reset after a
+// successful accept.
+type Backoff struct {
+	// the delay of the first retry, 0 means 5ms
+	Initial time.Duration `yaml:"initial"`
+	// the cap of delay, 0 means 1s
+	Max time.Duration `yaml:"max"`
+	// the delay is multiplied by it after each consecutive failure, 0 means 2
+	Multiplier float64 `yaml:"multiplier"`
+	// the accept loop gives up after so many consecutive failures, 0 means never
+	MaxRetries int `yaml:"maxRetries"`
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Initial <= 0 {
+		b.Initial = 5 * time.Millisecond
+	}
+	if b.Max <= 0 {
+		b.Max = time.Second
+	}
+	if b.Multiplier <= 0 {
+		b.Multiplier = 2
+	}
+	return b
+}
+
+// Delay returns the delay before the nth consecutive retry, n starts from 1
+func (b Backoff) Delay(n int) time.Duration {
+	b = b.withDefaults()
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(max(n-1, 0)))
+	if delay > float64(b.Max) {
+		return b.Max
+	}
+	return time.Duration(delay)
+}
+
+// temporaryErrors are the accept errors which the listener can recover from
+var temporaryErrors = []error{
+	// too many open files of process or system
+	syscall.EMFILE,
+	syscall.ENFILE,
+	// the connection is aborted before accepted
+	syscall.ECONNABORTED,
+	syscall.ECONNRESET,
+	syscall.ENOBUFS,
+	syscall.ENOMEM,
+	syscall.EAGAIN,
+	syscall.EINTR,
+}
+
+// isTemporary reports whether the accept error is temporary
+func isTemporary(err error) bool {
+	var neterr net.Error
+	if errors.As(err, &neterr) && neterr.Timeout() {
+		return true
+	}
+
+	for _, target := range temporaryErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
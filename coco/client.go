@@ -0,0 +1,154 @@
+package coco
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client is created for every accepted connection, it can be used as a net.Conn and
+// it holds the per-connection state, which lives as long as the connection.
+type Client struct {
+	net.Conn
+
+	id        uint64
+	createdAt time.Time
+
+	// cancelled after the connection is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// idle is true when client is waiting for a new request, that is, nothing has been read
+	// since the last reply was written
+	idle atomic.Bool
+	// draining is set during shutdown, the client ends at its next idle read
+	draining atomic.Bool
+
+	mu            sync.Mutex
+	name          string
+	lastCommand   string
+	lastCommandAt time.Time
+	// handler-defined state, e.g. selected db, auth status and transaction queue
+	value any
+}
+
+func newClient(ctx context.Context, id uint64, conn net.Conn) *Client {
+	cctx, cancel := context.WithCancel(ctx)
+	client := &Client{
+		Conn:      conn,
+		id:        id,
+		createdAt: time.Now(),
+		ctx:       cctx,
+		cancel:    cancel,
+	}
+	client.idle.Store(true)
+	return client
+}
+
+// Read returns io.EOF if the server is draining and client is waiting for a new request,
+// so the handler finishes the connection as if the client had closed it.
+func (c *Client) Read(p []byte) (int, error) {
+	if c.draining.Load() && c.idle.Load() {
+		return 0, io.EOF
+	}
+
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.idle.Store(false)
+	}
+	// the blocking read is interrupted by drain
+	if err != nil && n == 0 && c.draining.Load() && c.idle.Load() && errors.Is(err, os.ErrDeadlineExceeded) {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (c *Client) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.idle.Store(true)
+	}
+	return n, err
+}
+
+// drain marks the client as draining and wakes up the idle read, the busy client
+// will end after its in-flight request is replied.
+func (c *Client) drain() {
+	c.draining.Store(true)
+	if c.idle.Load() {
+		c.Conn.SetReadDeadline(time.Now())
+	}
+}
+
+// ID returns the unique id of client in the server
+func (c *Client) ID() uint64 {
+	return c.id
+}
+
+func (c *Client) CreatedAt() time.Time {
+	return c.createdAt
+}
+
+// Context returns the context which is cancelled after the client is closed or the server is stopped
+func (c *Client) Context() context.Context {
+	return c.ctx
+}
+
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+func (c *Client) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+// LastCommand returns the last command executed by client and when it was executed
+func (c *Client) LastCommand() (string, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastCommand, c.lastCommandAt
+}
+
+func (c *Client) SetLastCommand(cmd string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCommand = cmd
+	c.lastCommandAt = time.Now()
+}
+
+// UpstreamAddr returns the address of the peer, it differs from RemoteAddr
+// if the connection is proxied with PROXY protocol, see NewProxyListener.
+func (c *Client) UpstreamAddr() net.Addr {
+	if pc := proxyConnOf(c.Conn); pc != nil {
+		return pc.UpstreamAddr()
+	}
+	return c.RemoteAddr()
+}
+
+// Value returns the handler-defined state
+func (c *Client) Value() any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+func (c *Client) SetValue(value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value = value
+}
+
+// Close closes the connection and cancels the context of client
+func (c *Client) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
@@ -12,19 +12,25 @@ import (
 )
 
 const (
-	protocol = "tcp"
+	protocolTCP  = "tcp"
+	protocolUnix = "unix"
 )
 
 var (
-	ErrServerStopped       = errors.New("coco: server already stopped")
-	ErrInvalidListener     = errors.New("coco: invalid net listener")
-	ErrInvalidHandler      = errors.New("coco: invalid handler")
-	ErrUnsupportedProtocol = errors.New("coco: unsupported protocol")
-	ErrClosedTimeout       = errors.New("coco: server closed connection timeout")
+	ErrServerStopped        = errors.New("coco: server already stopped")
+	ErrInvalidListener      = errors.New("coco: invalid net listener")
+	ErrInvalidHandler       = errors.New("coco: invalid handler")
+	ErrUnsupportedProtocol  = errors.New("coco: unsupported protocol")
+	ErrClosedTimeout        = errors.New("coco: server closed connection timeout")
+	ErrListenerExists       = errors.New("coco: listener already exists")
+	ErrListenerNotFound     = errors.New("coco: listener not found")
+	ErrListenerClosed       = errors.New("coco: listener closed")
+	ErrReusePortUnsupported = errors.New("coco: SO_REUSEPORT is only supported on linux")
 )
 
 type Handler interface {
-	Handle(ctx context.Context, conn net.Conn)
+	// Handle serves the client until the connection is closed, ctx is the context of client
+	Handle(ctx context.Context, client *Client)
 	Close() error
 }
 
@@ -35,7 +41,9 @@ type CocoHandler struct {
 	mu      sync.Mutex
 }
 
-func (c *CocoHandler) Handle(ctx context.Context, conn net.Conn) {
+func (c *CocoHandler) Handle(ctx context.Context, client *Client) {
+	var conn net.Conn = client
+
 	if c.closing.Load() {
 		conn.Close()
 		return
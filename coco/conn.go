@@ -0,0 +1,112 @@
+package coco
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// timeoutConn applies the timeouts of Config on every Read and Write.
+// A connection is idle when it is waiting for a new request, that is, right after being accepted
+// or after a reply has been written, the idle timeout is used for reading in this state, otherwise
+// the read timeout is used, which bounds how long a partially received request may stall.
+type timeoutConn struct {
+	net.Conn
+
+	idle  time.Duration
+	read  time.Duration
+	write time.Duration
+
+	waiting atomic.Bool
+}
+
+func newTimeoutConn(conn net.Conn, cfg Config) net.Conn {
+	if cfg.Timeout <= 0 && cfg.ReadTimeout <= 0 && cfg.WriteTimeout <= 0 {
+		return conn
+	}
+
+	tc := &timeoutConn{
+		Conn:  conn,
+		idle:  cfg.Timeout,
+		read:  cfg.ReadTimeout,
+		write: cfg.WriteTimeout,
+	}
+	tc.waiting.Store(true)
+	return tc
+}
+
+func (t *timeoutConn) Read(p []byte) (int, error) {
+	timeout := t.read
+	if t.waiting.Load() {
+		timeout = t.idle
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := t.Conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	n, err := t.Conn.Read(p)
+	if n > 0 {
+		t.waiting.Store(false)
+	}
+	return n, err
+}
+
+func (t *timeoutConn) Write(p []byte) (int, error) {
+	if t.write > 0 {
+		if err := t.Conn.SetWriteDeadline(time.Now().Add(t.write)); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := t.Conn.Write(p)
+	if n > 0 {
+		t.waiting.Store(true)
+	}
+	return n, err
+}
+
+// NetConn returns the underlying connection
+func (t *timeoutConn) NetConn() net.Conn {
+	return t.Conn
+}
+
+// unwrapConn finds the connection of type T in the wrapped connections, the wrappers expose the connections
+// under them by NetConn, e.g. *tls.Conn, *ProxyConn and *timeoutConn.
+func unwrapConn[T net.Conn](conn net.Conn) (T, bool) {
+	for conn != nil {
+		if c, ok := conn.(T); ok {
+			return c, true
+		}
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = wrapper.NetConn()
+	}
+	var zero T
+	return zero, false
+}
+
+// setKeepAlive configures TCP keepalive, negative period disables it, zero keeps the system default.
+// The wrapped connections are unwrapped to the tcp connection, so it also applies to the tls listeners
+// and the PROXY protocol listeners.
+func setKeepAlive(conn net.Conn, period time.Duration) error {
+	tcpConn, ok := unwrapConn[*net.TCPConn](conn)
+	if !ok || period == 0 {
+		return nil
+	}
+
+	if period < 0 {
+		return tcpConn.SetKeepAlive(false)
+	}
+
+	if err := tcpConn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tcpConn.SetKeepAlivePeriod(period)
+}
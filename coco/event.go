@@ -0,0 +1,152 @@
+package coco
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+var ErrEventLoopUnsupported = errors.New("coco: event-loop mode is only supported on linux")
+
+// EventHandler handles the connections in event-loop mode, the connections are multiplexed over a fixed
+// number of loop goroutines, the callbacks of a connection are called sequentially in its loop, so they
+// must not block, otherwise all the connections of the loop are stalled.
+type EventHandler interface {
+	// OnOpen is called after the connection is registered in a loop
+	OnOpen(conn *EventConn)
+	// OnData is called with the received data, and returns how many bytes are consumed, the unconsumed
+	// bytes, e.g. an incomplete request, are passed again with the following data. data is only valid
+	// during the call. Returning an error closes the connection after the pending replies are written.
+	OnData(conn *EventConn, data []byte) (int, error)
+	// OnClose is called after the connection is closed, err is nil if it is closed by peer or by Close
+	OnClose(conn *EventConn, err error)
+	Close() error
+}
+
+// EventConn is a connection served in event-loop mode, it is not safe for concurrent use,
+// its methods should only be called in the callbacks of EventHandler.
+type EventConn struct {
+	fd   int
+	id   uint64
+	loop *eventLoop
+
+	handler       EventHandler
+	local, remote net.Addr
+	createdAt     time.Time
+	lastActive    time.Time
+
+	// unconsumed input and pending output
+	in, out []byte
+	// whether EPOLLOUT is registered for pending output
+	writing bool
+	// close after the pending output is written
+	closing  bool
+	closeErr error
+	closed   bool
+
+	// called after the connection is closed
+	done func()
+
+	name          string
+	lastCommand   string
+	lastCommandAt time.Time
+	value         any
+}
+
+// ID returns the unique id of connection in the server, it shares the id space with Client
+func (c *EventConn) ID() uint64 {
+	return c.id
+}
+
+func (c *EventConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *EventConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *EventConn) CreatedAt() time.Time {
+	return c.createdAt
+}
+
+func (c *EventConn) Name() string {
+	return c.name
+}
+
+func (c *EventConn) SetName(name string) {
+	c.name = name
+}
+
+// LastCommand returns the last command executed by the connection and when it was executed
+func (c *EventConn) LastCommand() (string, time.Time) {
+	return c.lastCommand, c.lastCommandAt
+}
+
+func (c *EventConn) SetLastCommand(cmd string) {
+	c.lastCommand = cmd
+	c.lastCommandAt = time.Now()
+}
+
+// Value returns the handler-defined state
+func (c *EventConn) Value() any {
+	return c.value
+}
+
+func (c *EventConn) SetValue(value any) {
+	c.value = value
+}
+
+// Write appends p to the output buffer, which is written after the callback returns
+func (c *EventConn) Write(p []byte) (int, error) {
+	if c.closed || c.closing {
+		return 0, net.ErrClosed
+	}
+	c.out = append(c.out, p...)
+	return len(p), nil
+}
+
+// Close closes the connection after the pending output is written
+func (c *EventConn) Close() error {
+	if c.closed || c.closing {
+		return net.ErrClosed
+	}
+	c.closing = true
+	return nil
+}
+
+// ServeEvents is the same as Serve but serves the connections in event-loop mode, the loops are shared by all the
+// listeners served in this mode, and their number is Config.EventLoops. Only the plain tcp and unix listeners are
+// supported since the connections are read and written by the loops directly, the middlewares, the read and write
+// timeouts are not applied, and the connections are not listed in Clients.
+func (s *Server) ServeEvents(lis net.Listener, handler EventHandler) error {
+	if err := s.startLoops(); err != nil {
+		return err
+	}
+
+	sl, err := s.addListener([]net.Listener{lis}, handler)
+	if err != nil {
+		return err
+	}
+
+	return s.serve(sl, func(sl *serveListener, conn net.Conn) {
+		s.serveEventConn(sl, conn, handler)
+	})
+}
+
+// AddEvents is the same as AddGroup but serves the listeners in event-loop mode, see ServeEvents
+func (s *Server) AddEvents(lns []net.Listener, handler EventHandler) error {
+	if err := s.startLoops(); err != nil {
+		return err
+	}
+
+	sl, err := s.addListener(lns, handler)
+	if err != nil {
+		return err
+	}
+
+	s.serveBackground(sl, func(sl *serveListener, conn net.Conn) {
+		s.serveEventConn(sl, conn, handler)
+	})
+	return nil
+}
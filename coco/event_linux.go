@@ -0,0 +1,495 @@
+package coco
+
+import (
+	"fmt"
+	"github.com/246859/codis/pkg/logger"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// size of the read buffer shared by the connections of a loop
+	loopBufferSize = 64 * 1024
+	// the buffers larger than it are released after being drained
+	maxKeptBufferSize = 64 * 1024
+	// how often the loop checks the idle connections
+	idleSweepInterval = time.Second
+)
+
+// eventLoop multiplexes the connections over an epoll instance, the connections are only
+// accessed by the loop goroutine, the other goroutines communicate with it by the eventfd.
+type eventLoop struct {
+	server *Server
+
+	epfd   int
+	wakefd int
+	buf    []byte
+	conns  map[int]*EventConn
+
+	lastSweep time.Time
+
+	// the fields below are guarded by mu
+	mu       sync.Mutex
+	pending  []*EventConn
+	stopping bool
+	stopAt   time.Time
+	// the descriptors are closed, their numbers may be reused by other files
+	released bool
+
+	// the connections when the loop starts stopping
+	stopTotal int
+	stats     DrainStats
+	done      chan struct{}
+}
+
+func newEventLoop(s *Server) (*eventLoop, error) {
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("epoll_create1", err)
+	}
+
+	wakefd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		unix.Close(epfd)
+		return nil, os.NewSyscallError("eventfd", err)
+	}
+
+	event := &unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(wakefd)}
+	if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, wakefd, event); err != nil {
+		unix.Close(epfd)
+		unix.Close(wakefd)
+		return nil, os.NewSyscallError("epoll_ctl", err)
+	}
+
+	return &eventLoop{
+		server:    s,
+		epfd:      epfd,
+		wakefd:    wakefd,
+		buf:       make([]byte, loopBufferSize),
+		conns:     make(map[int]*EventConn),
+		lastSweep: time.Now(),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// startLoops creates the event loops at the first call
+func (s *Server) startLoops() error {
+	s.loopsOnce.Do(func() {
+		n := s.cfg.EventLoops
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+
+		loops := make([]*eventLoop, 0, n)
+		for i := 0; i < n; i++ {
+			loop, err := newEventLoop(s)
+			if err != nil {
+				for _, l := range loops {
+					l.release()
+				}
+				s.loopsErr = err
+				return
+			}
+			loops = append(loops, loop)
+		}
+
+		for _, loop := range loops {
+			go loop.run()
+		}
+		s.loops = loops
+	})
+	return s.loopsErr
+}
+
+// stopLoops stops the loops gracefully, the connections have no unconsumed input and pending output are closed,
+// the others are given time to finish until the deadline.
+func (s *Server) stopLoops(deadline time.Time) DrainStats {
+	for _, loop := range s.loops {
+		loop.stop(deadline)
+	}
+
+	var stats DrainStats
+	for _, loop := range s.loops {
+		<-loop.done
+		stats.Drained += loop.stats.Drained
+		stats.Killed += loop.stats.Killed
+	}
+	return stats
+}
+
+// serveEventConn detaches the file descriptor from conn and registers it in a loop
+func (s *Server) serveEventConn(sl *serveListener, conn net.Conn, handler EventHandler) {
+	done := func() {
+		s.releaseConn()
+		sl.connCount.Add(-1)
+	}
+
+	fd, err := detachFd(conn)
+	if err != nil {
+		logger.Warnf("serve %s in event loop failed: %s", conn.RemoteAddr(), err)
+		conn.Close()
+		done()
+		return
+	}
+
+	now := time.Now()
+	c := &EventConn{
+		fd:         fd,
+		id:         s.clientID.Add(1),
+		handler:    handler,
+		local:      conn.LocalAddr(),
+		remote:     conn.RemoteAddr(),
+		createdAt:  now,
+		lastActive: now,
+		done:       done,
+	}
+
+	// the connections are distributed over the loops by round-robin
+	loop := s.loops[s.nextLoop.Add(1)%uint64(len(s.loops))]
+	loop.register(c)
+}
+
+// detachFd duplicates the file descriptor of conn and closes conn,
+// so the descriptor is no longer polled by the go runtime.
+func detachFd(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return -1, fmt.Errorf("%w: %T", ErrUnsupportedProtocol, conn)
+	}
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+
+	fd := -1
+	var dupErr error
+	if err := rc.Control(func(sysfd uintptr) {
+		fd, dupErr = unix.FcntlInt(sysfd, unix.F_DUPFD_CLOEXEC, 0)
+	}); err != nil {
+		return -1, err
+	} else if dupErr != nil {
+		return -1, os.NewSyscallError("fcntl", dupErr)
+	}
+
+	conn.Close()
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return -1, os.NewSyscallError("setnonblock", err)
+	}
+	return fd, nil
+}
+
+func (l *eventLoop) register(c *EventConn) {
+	c.loop = l
+
+	l.mu.Lock()
+	if l.stopping {
+		l.mu.Unlock()
+		unix.Close(c.fd)
+		c.done()
+		return
+	}
+	l.pending = append(l.pending, c)
+	l.mu.Unlock()
+
+	l.wake()
+}
+
+func (l *eventLoop) stop(deadline time.Time) {
+	l.mu.Lock()
+	l.stopping = true
+	l.stopAt = deadline
+	l.mu.Unlock()
+
+	l.wake()
+}
+
+// wake wakes up the loop, it does nothing after the loop is released,
+// otherwise the write may land in another file which reuses the number of wakefd.
+func (l *eventLoop) wake() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return
+	}
+
+	var one = [8]byte{1}
+	unix.Write(l.wakefd, one[:])
+}
+
+// discard closes the connections queued but not registered yet, and makes the later ones closed by register,
+// it is called when the loop stops, otherwise their descriptors and connection counts are leaked.
+func (l *eventLoop) discard() {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending, l.stopping = nil, true
+	l.mu.Unlock()
+
+	for _, c := range pending {
+		unix.Close(c.fd)
+		c.done()
+	}
+}
+
+func (l *eventLoop) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return
+	}
+	l.released = true
+
+	unix.Close(l.epfd)
+	unix.Close(l.wakefd)
+}
+
+func (l *eventLoop) run() {
+	defer close(l.done)
+	defer l.release()
+	defer l.discard()
+
+	events := make([]unix.EpollEvent, 256)
+	for {
+		n, err := unix.EpollWait(l.epfd, events, l.waitTimeout())
+		if err != nil && err != unix.EINTR {
+			logger.Error("event loop stopped: ", os.NewSyscallError("epoll_wait", err))
+			for _, c := range l.conns {
+				l.close(c, err)
+			}
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Fd)
+			if fd == l.wakefd {
+				l.accept()
+				continue
+			}
+
+			if c, ok := l.conns[fd]; ok {
+				l.process(c, events[i].Events)
+			}
+		}
+
+		if l.tick() {
+			return
+		}
+	}
+}
+
+// waitTimeout returns the timeout of epoll_wait in milliseconds
+func (l *eventLoop) waitTimeout() int {
+	l.mu.Lock()
+	stopping := l.stopping
+	l.mu.Unlock()
+
+	if stopping {
+		return int(drainInterval / time.Millisecond)
+	} else if l.server.cfg.Timeout > 0 {
+		return int(idleSweepInterval / time.Millisecond)
+	}
+	return -1
+}
+
+// accept registers the pending connections
+func (l *eventLoop) accept() {
+	var buf [8]byte
+	unix.Read(l.wakefd, buf[:])
+
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	for _, c := range pending {
+		event := &unix.EpollEvent{Events: unix.EPOLLIN | unix.EPOLLRDHUP, Fd: int32(c.fd)}
+		if err := unix.EpollCtl(l.epfd, unix.EPOLL_CTL_ADD, c.fd, event); err != nil {
+			logger.Warnf("register %s in event loop failed: %s", c.remote, err)
+			unix.Close(c.fd)
+			c.done()
+			continue
+		}
+		l.conns[c.fd] = c
+
+		l.callback(c, func() error {
+			c.handler.OnOpen(c)
+			return nil
+		})
+	}
+}
+
+func (l *eventLoop) process(c *EventConn, events uint32) {
+	if events&(unix.EPOLLIN|unix.EPOLLRDHUP|unix.EPOLLHUP|unix.EPOLLERR) != 0 {
+		l.read(c)
+	}
+	if events&unix.EPOLLOUT != 0 && !c.closed {
+		l.flush(c)
+	}
+}
+
+func (l *eventLoop) read(c *EventConn) {
+	n, err := unix.Read(c.fd, l.buf)
+	if err == unix.EAGAIN || err == unix.EINTR {
+		return
+	} else if err != nil {
+		l.close(c, os.NewSyscallError("read", err))
+		return
+	} else if n == 0 {
+		l.close(c, nil)
+		return
+	}
+	c.lastActive = time.Now()
+
+	// the shared buffer is passed directly unless there is unconsumed input
+	data := l.buf[:n]
+	buffered := len(c.in) > 0
+	if buffered {
+		c.in = append(c.in, data...)
+		data = c.in
+	}
+
+	l.callback(c, func() error {
+		consumed, err := c.handler.OnData(c, data)
+		consumed = min(max(consumed, 0), len(data))
+
+		rest := data[consumed:]
+		if buffered {
+			c.in = c.in[:copy(c.in, rest)]
+		} else if len(rest) > 0 {
+			c.in = append(c.in, rest...)
+		}
+		if len(c.in) == 0 && cap(c.in) > maxKeptBufferSize {
+			c.in = nil
+		}
+		return err
+	})
+}
+
+// callback calls fn and writes the output, the connection is closed if fn returns an error or panics
+func (l *eventLoop) callback(c *EventConn, fn func() error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("event conn %d %s: handler panic: %v", c.id, c.remote, r)
+			l.close(c, fmt.Errorf("coco: handler panic: %v", r))
+		}
+	}()
+
+	if err := fn(); err != nil && !c.closing {
+		c.closing = true
+		c.closeErr = err
+	}
+	l.flush(c)
+}
+
+// flush writes the pending output as much as possible, and waits for EPOLLOUT if the socket buffer is full
+func (l *eventLoop) flush(c *EventConn) {
+	if c.closed {
+		return
+	}
+
+	written := 0
+	for written < len(c.out) {
+		n, err := unix.Write(c.fd, c.out[written:])
+		if err == unix.EINTR {
+			continue
+		} else if err == unix.EAGAIN {
+			break
+		} else if err != nil {
+			l.close(c, os.NewSyscallError("write", err))
+			return
+		}
+		written += n
+	}
+	c.out = c.out[:copy(c.out, c.out[written:])]
+
+	if len(c.out) == 0 {
+		if cap(c.out) > maxKeptBufferSize {
+			c.out = nil
+		}
+		if c.closing {
+			l.close(c, c.closeErr)
+			return
+		}
+	}
+
+	if writing := len(c.out) > 0; writing != c.writing {
+		events := uint32(unix.EPOLLIN | unix.EPOLLRDHUP)
+		if writing {
+			events |= unix.EPOLLOUT
+		}
+		event := &unix.EpollEvent{Events: events, Fd: int32(c.fd)}
+		if err := unix.EpollCtl(l.epfd, unix.EPOLL_CTL_MOD, c.fd, event); err != nil {
+			l.close(c, os.NewSyscallError("epoll_ctl", err))
+			return
+		}
+		c.writing = writing
+	}
+}
+
+func (l *eventLoop) close(c *EventConn, err error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+
+	unix.EpollCtl(l.epfd, unix.EPOLL_CTL_DEL, c.fd, nil)
+	unix.Close(c.fd)
+	delete(l.conns, c.fd)
+	c.in, c.out = nil, nil
+
+	// the connection is uncounted even if OnClose panics, and the panic does not stop the loop
+	defer c.done()
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("event conn %d %s: handler panic on close: %v", c.id, c.remote, r)
+		}
+	}()
+	c.handler.OnClose(c, err)
+}
+
+// tick closes the idle connections and drains the connections while stopping,
+// returns true if the loop is stopped.
+func (l *eventLoop) tick() bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	stopping, stopAt := l.stopping, l.stopAt
+	l.mu.Unlock()
+
+	if stopping {
+		l.discard()
+		if l.stopTotal == 0 {
+			l.stopTotal = len(l.conns)
+		}
+		for _, c := range l.conns {
+			if len(c.in) == 0 && len(c.out) == 0 {
+				l.close(c, nil)
+			} else if !now.Before(stopAt) {
+				l.stats.Killed++
+				l.close(c, ErrServerStopped)
+			}
+		}
+		if len(l.conns) == 0 {
+			l.stats.Drained = l.stopTotal - l.stats.Killed
+			return true
+		}
+		return false
+	}
+
+	timeout := l.server.cfg.Timeout
+	if timeout > 0 && now.Sub(l.lastSweep) >= idleSweepInterval {
+		l.lastSweep = now
+		for _, c := range l.conns {
+			if len(c.in) == 0 && now.Sub(c.lastActive) > timeout {
+				l.close(c, os.ErrDeadlineExceeded)
+			}
+		}
+	}
+	return false
+}
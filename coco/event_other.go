@@ -0,0 +1,24 @@
+//go:build !linux
+
+package coco
+
+import (
+	"net"
+	"time"
+)
+
+type eventLoop struct{}
+
+func (s *Server) startLoops() error {
+	return ErrEventLoopUnsupported
+}
+
+func (s *Server) stopLoops(deadline time.Time) DrainStats {
+	return DrainStats{}
+}
+
+func (s *Server) serveEventConn(sl *serveListener, conn net.Conn, handler EventHandler) {
+	conn.Close()
+	s.releaseConn()
+	sl.connCount.Add(-1)
+}
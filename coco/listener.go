@@ -0,0 +1,126 @@
+package coco
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"time"
+)
+
+var (
+	ErrSocketInUse  = errors.New("coco: unix socket is in use")
+	ErrNotSocket    = errors.New("coco: file exists and is not a unix socket")
+	ErrInvalidCA    = errors.New("coco: no valid certificate found in CA file")
+	ErrInvalidAuth  = errors.New("coco: invalid tls client auth, expected no, optional or yes")
+	ErrMissingCA    = errors.New("coco: CA file is required for verifying client certificates")
+	ErrMissingCerts = errors.New("coco: both cert file and key file are required")
+)
+
+// ListenUnix listen on a unix domain socket with specified permissions, the stale socket
+// file left by a crashed process will be removed, the socket file is removed after the listener closed.
+func ListenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			lis.Close()
+			return nil, err
+		}
+	}
+	return lis, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%w: %s", ErrNotSocket, path)
+	}
+
+	// someone is still listening on it
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s", ErrSocketInUse, path)
+	}
+
+	return os.Remove(path)
+}
+
+// TLSConfig describes the certificates used by tls listener
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// CA certificates to verify client certificates
+	CAFile string `yaml:"caFile"`
+	// whether to verify client certificates: no, optional or yes, same as tls-auth-clients in redis.conf
+	AuthClients string `yaml:"authClients"`
+}
+
+// NewTLSConfig loads the certificates and build *tls.Config for server side
+func NewTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, ErrMissingCerts
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	switch cfg.AuthClients {
+	case "", "no":
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "yes":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAuth, cfg.AuthClients)
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCA, cfg.CAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	} else if tlsConfig.ClientAuth != tls.NoClientCert {
+		return nil, ErrMissingCA
+	}
+
+	return tlsConfig, nil
+}
+
+// ListenTLS listen on the tcp address and serve tls with the certificates described by cfg
+func ListenTLS(addr string, cfg TLSConfig) (net.Listener, error) {
+	tlsConfig, err := NewTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", addr, tlsConfig)
+}
@@ -0,0 +1,66 @@
+package coco
+
+import (
+	"context"
+	"github.com/246859/codis/pkg/logger"
+	"runtime/debug"
+)
+
+// HandlerFunc is the function form of Handler.Handle
+type HandlerFunc func(ctx context.Context, client *Client)
+
+// Middleware wraps the HandlerFunc with cross-cutting concerns, e.g. logging, panic recovery, metrics and
+// access control, it can end the connection early by returning without calling next.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain is a list of middlewares, the first one is the outermost
+type Chain []Middleware
+
+func NewChain(mws ...Middleware) Chain {
+	return append(Chain(nil), mws...)
+}
+
+// Append returns a new chain with mws appended, the original chain is not modified
+func (c Chain) Append(mws ...Middleware) Chain {
+	chain := make(Chain, 0, len(c)+len(mws))
+	chain = append(chain, c...)
+	return append(chain, mws...)
+}
+
+// Then wraps the handler with the middlewares, Close of the returned handler is delegated to the handler
+func (c Chain) Then(handler Handler) Handler {
+	if len(c) == 0 {
+		return handler
+	}
+
+	fn := HandlerFunc(handler.Handle)
+	for i := len(c) - 1; i >= 0; i-- {
+		fn = c[i](fn)
+	}
+	return &chainHandler{Handler: handler, handle: fn}
+}
+
+type chainHandler struct {
+	Handler
+	handle HandlerFunc
+}
+
+func (c *chainHandler) Handle(ctx context.Context, client *Client) {
+	c.handle(ctx, client)
+}
+
+// Recovery recovers the panic of handler, logs the stack and closes the client,
+// so a panicking handler does not crash the whole server.
+func Recovery() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, client *Client) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Errorf("client %d %s: handler panic: %v\n%s", client.ID(), client.RemoteAddr(), r, debug.Stack())
+					client.Close()
+				}
+			}()
+			next(ctx, client)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package coco
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrProxyHeaderMissing = errors.New("coco: PROXY protocol header is required")
+	ErrProxyUntrusted     = errors.New("coco: PROXY protocol header from untrusted upstream")
+	ErrInvalidProxyHeader = errors.New("coco: invalid PROXY protocol header")
+	ErrInvalidCIDR        = errors.New("coco: invalid trusted CIDR")
+)
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	// max length of v1 header including CRLF
+	proxyV1MaxLen = 107
+	// length of the fixed part of v2 header
+	proxyV2HeaderLen = 16
+)
+
+// ProxyConfig describes how to handle the HAProxy PROXY protocol headers
+type ProxyConfig struct {
+	// parse the PROXY protocol v1 and v2 headers on new connections
+	Enabled bool `yaml:"enabled"`
+	// reject the connections without a header, and the connections from untrusted upstreams
+	Required bool `yaml:"required"`
+	// the upstreams allowed to send the header, e.g. 10.0.0.0/8 or 192.168.1.10, empty means all,
+	// the connections from the others are served as direct connections
+	TrustedCIDRs []string `yaml:"trustedCIDRs"`
+	// max duration of reading the header, 0 means the default 5s
+	HeaderTimeout time.Duration `yaml:"headerTimeout"`
+}
+
+// Validate checks the trusted CIDRs and the header timeout
+func (c ProxyConfig) Validate() error {
+	if c.HeaderTimeout < 0 {
+		return fmt.Errorf("coco: negative PROXY protocol header timeout %s", c.HeaderTimeout)
+	}
+	_, err := c.trustedNets()
+	return err
+}
+
+func (c ProxyConfig) trustedNets() ([]*net.IPNet, error) {
+	trusted := make([]*net.IPNet, 0, len(c.TrustedCIDRs))
+	for _, cidr := range c.TrustedCIDRs {
+		// a single address
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := len(ip) * 8
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCIDR, cidr)
+		}
+		trusted = append(trusted, ipNet)
+	}
+	return trusted, nil
+}
+
+// NewProxyListener wraps the listener, the accepted connections are *ProxyConn which read the PROXY protocol header
+// before the first Read. To use it with tls, wrap the proxy listener by tls.NewListener. It is not supported in
+// event-loop mode.
+func NewProxyListener(lis net.Listener, cfg ProxyConfig) (net.Listener, error) {
+	trusted, err := cfg.trustedNets()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.HeaderTimeout == 0 {
+		cfg.HeaderTimeout = 5 * time.Second
+	}
+
+	return &proxyListener{Listener: lis, cfg: cfg, trusted: trusted}, nil
+}
+
+type proxyListener struct {
+	net.Listener
+	cfg     ProxyConfig
+	trusted []*net.IPNet
+}
+
+func (p *proxyListener) Accept() (net.Conn, error) {
+	conn, err := p.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyConn{Conn: conn, cfg: p.cfg, trusted: p.isTrusted(conn.RemoteAddr())}, nil
+}
+
+func (p *proxyListener) isTrusted(addr net.Addr) bool {
+	if len(p.trusted) == 0 {
+		return true
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range p.trusted {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyConn is a connection accepted by the proxy listener, its RemoteAddr and LocalAddr return the addresses
+// carried by the PROXY protocol header after the header is read.
+type ProxyConn struct {
+	net.Conn
+	cfg     ProxyConfig
+	trusted bool
+
+	once      sync.Once
+	headerErr error
+	done      atomic.Bool
+
+	// buffered bytes read along with the header
+	reader *bufio.Reader
+
+	version       int
+	local, remote net.Addr
+}
+
+// ReadHeader reads the PROXY protocol header, it is called by the first Read automatically,
+// the server calls it before handling the connection.
+func (p *ProxyConn) ReadHeader() error {
+	p.once.Do(func() {
+		p.headerErr = p.readHeader()
+		p.done.Store(true)
+	})
+	return p.headerErr
+}
+
+func (p *ProxyConn) readHeader() error {
+	if !p.trusted {
+		if p.cfg.Required {
+			return fmt.Errorf("%w: %s", ErrProxyUntrusted, p.Conn.RemoteAddr())
+		}
+		return nil
+	}
+
+	if err := p.Conn.SetReadDeadline(time.Now().Add(p.cfg.HeaderTimeout)); err != nil {
+		return err
+	}
+	defer p.Conn.SetReadDeadline(time.Time{})
+
+	p.reader = bufio.NewReaderSize(p.Conn, 256)
+
+	version, err := p.detect()
+	if err != nil {
+		return err
+	}
+
+	switch version {
+	case 1:
+		err = p.readV1()
+	case 2:
+		err = p.readV2()
+	default:
+		if p.cfg.Required {
+			return ErrProxyHeaderMissing
+		}
+	}
+	if err != nil {
+		return err
+	}
+	p.version = version
+	return nil
+}
+
+// detect peeks the beginning bytes one by one, so it does not wait for more bytes than the
+// direct client sends, it returns 0 if there is no header.
+func (p *ProxyConn) detect() (int, error) {
+	v1, v2 := true, true
+	for n := 1; v1 || v2; n++ {
+		peek, err := p.reader.Peek(n)
+		if err != nil {
+			return 0, err
+		}
+
+		v1 = v1 && n <= len(proxyV1Prefix) && bytes.HasPrefix(proxyV1Prefix, peek)
+		v2 = v2 && n <= len(proxyV2Signature) && bytes.HasPrefix(proxyV2Signature, peek)
+		if v1 && n == len(proxyV1Prefix) {
+			return 1, nil
+		} else if v2 && n == len(proxyV2Signature) {
+			return 2, nil
+		}
+	}
+	return 0, nil
+}
+
+// readV1 parses the human-readable header, e.g. "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func (p *ProxyConn) readV1() error {
+	var line []byte
+	for len(line) < proxyV1MaxLen {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return fmt.Errorf("%w: v1 header is too long or not terminated by CRLF", ErrInvalidProxyHeader)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		// the addresses are unknown, keep the upstream addresses
+		return nil
+	} else if len(fields) != 6 || fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return fmt.Errorf("%w: %q", ErrInvalidProxyHeader, line)
+	}
+
+	src, err := parseV1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+	dst, err := parseV1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+	p.remote, p.local = src, dst
+	return nil
+}
+
+func parseV1Addr(family, ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil || (family == "TCP4") != (addr.To4() != nil) {
+		return nil, fmt.Errorf("%w: invalid address %s", ErrInvalidProxyHeader, ip)
+	}
+
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return nil, fmt.Errorf("%w: invalid port %s", ErrInvalidProxyHeader, port)
+	}
+	return &net.TCPAddr{IP: addr, Port: int(portNum)}, nil
+}
+
+// readV2 parses the binary header
+func (p *ProxyConn) readV2() error {
+	var header [proxyV2HeaderLen]byte
+	if _, err := io.ReadFull(p.reader, header[:]); err != nil {
+		return err
+	}
+
+	if header[12]>>4 != 2 {
+		return fmt.Errorf("%w: unsupported v2 version %d", ErrInvalidProxyHeader, header[12]>>4)
+	}
+	command, family := header[12]&0x0f, header[13]
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(p.reader, payload); err != nil {
+		return err
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL, e.g. health checks from the proxy itself, keep the upstream addresses
+		return nil
+	case 0x1:
+		// PROXY
+	default:
+		return fmt.Errorf("%w: unsupported v2 command %d", ErrInvalidProxyHeader, command)
+	}
+
+	// the address family in the high 4 bits and the transport protocol in the low 4 bits
+	switch family {
+	case 0x11:
+		if len(payload) < 12 {
+			return fmt.Errorf("%w: short IPv4 addresses", ErrInvalidProxyHeader)
+		}
+		p.remote = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		p.local = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+	case 0x21:
+		if len(payload) < 36 {
+			return fmt.Errorf("%w: short IPv6 addresses", ErrInvalidProxyHeader)
+		}
+		p.remote = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		p.local = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	default:
+		// unspecified, udp or unix addresses, keep the upstream addresses
+	}
+	return nil
+}
+
+func (p *ProxyConn) Read(b []byte) (int, error) {
+	if err := p.ReadHeader(); err != nil {
+		return 0, err
+	}
+
+	if p.reader != nil {
+		if p.reader.Buffered() > 0 {
+			return p.reader.Read(b)
+		}
+		p.reader = nil
+	}
+	return p.Conn.Read(b)
+}
+
+// RemoteAddr returns the client address carried by the header, or the upstream address
+// if the header has not been read or does not carry addresses.
+func (p *ProxyConn) RemoteAddr() net.Addr {
+	if p.done.Load() && p.remote != nil {
+		return p.remote
+	}
+	return p.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address carried by the header, or the local address
+// if the header has not been read or does not carry addresses.
+func (p *ProxyConn) LocalAddr() net.Addr {
+	if p.done.Load() && p.local != nil {
+		return p.local
+	}
+	return p.Conn.LocalAddr()
+}
+
+// UpstreamAddr returns the address of the peer, usually the load balancer
+func (p *ProxyConn) UpstreamAddr() net.Addr {
+	return p.Conn.RemoteAddr()
+}
+
+// Version returns the version of PROXY protocol header, 0 means there is no header
+func (p *ProxyConn) Version() int {
+	if !p.done.Load() {
+		return 0
+	}
+	return p.version
+}
+
+// NetConn returns the underlying connection, e.g. for setting TCP options
+func (p *ProxyConn) NetConn() net.Conn {
+	return p.Conn
+}
+
+// proxyConnOf finds the *ProxyConn in the wrapped connections, e.g. a tls connection over it
+func proxyConnOf(conn net.Conn) *ProxyConn {
+	pc, _ := unwrapConn[*ProxyConn](conn)
+	return pc
+}
@@ -0,0 +1,41 @@
+package coco
+
+import (
+	"context"
+	"golang.org/x/sys/unix"
+	"net"
+	"syscall"
+)
+
+// ListenReusePort opens n tcp listeners on the same address with SO_REUSEPORT, so the kernel
+// load-balances the incoming connections over them. If the port of address is 0, all the
+// listeners are bound to the port chosen by system for the first one.
+func ListenReusePort(network, address string, n int) ([]net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+
+	lns := make([]net.Listener, 0, max(n, 1))
+	for i := 0; i < max(n, 1); i++ {
+		lis, err := lc.Listen(context.Background(), network, address)
+		if err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+			return nil, err
+		}
+		if i == 0 {
+			address = lis.Addr().String()
+		}
+		lns = append(lns, lis)
+	}
+	return lns, nil
+}
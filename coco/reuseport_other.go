@@ -0,0 +1,12 @@
+//go:build !linux
+
+package coco
+
+import (
+	"net"
+)
+
+// ListenReusePort opens n tcp listeners on the same address with SO_REUSEPORT, it is only supported on linux.
+func ListenReusePort(network, address string, n int) ([]net.Listener, error) {
+	return nil, ErrReusePortUnsupported
+}
@@ -3,9 +3,11 @@ package coco
 import (
 	"context"
 	errors2 "errors"
+	"fmt"
 	"github.com/246859/codis/pkg/logger"
 	"github.com/246859/codis/pkg/util/syncx"
 	"github.com/pkg/errors"
+	"io"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -13,10 +15,36 @@ import (
 )
 
 type Config struct {
-	MaxConn      uint64        `yaml:"maxConn"`
-	Timeout      time.Duration `yaml:"timeout"`
+	MaxConn uint64 `yaml:"maxConn"`
+	// close the connection after the client is idle for Timeout, 0 means never, same as timeout in redis.conf
+	Timeout time.Duration `yaml:"timeout"`
+	// max duration of reading the rest of a partially received request, 0 means no limit
+	ReadTimeout time.Duration `yaml:"readTimeout"`
+	// max duration of a single write, it protects the server from slow consumers, 0 means no limit
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+	// TCP keepalive period, negative value disables it, 0 means using the system default
+	KeepAlive time.Duration `yaml:"keepAlive"`
+	// the drain window of Shutdown, connections still busy after it are closed forcibly,
+	// 0 means the default 10s, negative value closes them immediately
 	CloseTimeout time.Duration `yaml:"closeTimeout"`
-	Retry        time.Duration `yaml:"retry"`
+	// the policy of retrying accept on temporary errors
+	Backoff Backoff `yaml:"backoff"`
+	// Deprecated: use Backoff.Initial, a positive value overrides the initial delay of Backoff
+	Retry time.Duration `yaml:"retry"`
+
+	// RejectHook will be called with the connections exceed MaxConn, it runs in its own goroutine so that a slow
+	// client being rejected does not stall the accept loop, and the conn is closed after it returns
+	RejectHook func(conn net.Conn) `yaml:"-"`
+	// BackoffHook will be called before the accept loop sleeps for retrying, e.g. for collecting metrics
+	BackoffHook func(addr net.Addr, err error, attempt int, delay time.Duration) `yaml:"-"`
+	// number of listeners opened with SO_REUSEPORT by ListenAndServe, each of them has its own accept loop,
+	// 0 or 1 means a single listener
+	ReusePort int `yaml:"reusePort"`
+	// number of event loops used by ServeEvents, 0 means the number of CPUs
+	EventLoops int `yaml:"eventLoops"`
+
+	// Middlewares wrap the handlers served by the server, Recovery is always the outermost one
+	Middlewares []Middleware `yaml:"-"`
 }
 
 type Option func(cfg *Config)
@@ -25,24 +53,99 @@ func (o Option) apply(cfg *Config) {
 	o(cfg)
 }
 
+// WithConfig replace the whole config, the zero fields will be set to default values
+func WithConfig(config Config) Option {
+	return func(cfg *Config) {
+		*cfg = config
+	}
+}
+
 func WithTimeout(timeout time.Duration) Option {
 	return func(cfg *Config) {
 		cfg.Timeout = timeout
 	}
 }
 
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.ReadTimeout = timeout
+	}
+}
+
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.WriteTimeout = timeout
+	}
+}
+
+func WithKeepAlive(period time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.KeepAlive = period
+	}
+}
+
 func WithMaxConn(maxConn uint64) Option {
 	return func(cfg *Config) {
 		cfg.MaxConn = maxConn
 	}
 }
 
+// WithRejectHook set the hook to handle the connections exceed MaxConn, e.g. reply an error before closing
+func WithRejectHook(hook func(conn net.Conn)) Option {
+	return func(cfg *Config) {
+		cfg.RejectHook = hook
+	}
+}
+
+// WithReusePort set the number of listeners opened with SO_REUSEPORT by ListenAndServe
+func WithReusePort(n int) Option {
+	return func(cfg *Config) {
+		cfg.ReusePort = n
+	}
+}
+
+// WithEventLoops set the number of event loops used by ServeEvents
+func WithEventLoops(n int) Option {
+	return func(cfg *Config) {
+		cfg.EventLoops = n
+	}
+}
+
+// WithMiddleware appends the middlewares which wrap the handlers served by the server
+func WithMiddleware(mws ...Middleware) Option {
+	return func(cfg *Config) {
+		cfg.Middlewares = append(cfg.Middlewares, mws...)
+	}
+}
+
+func WithCloseTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.CloseTimeout = timeout
+	}
+}
+
+func WithBackoff(backoff Backoff) Option {
+	return func(cfg *Config) {
+		cfg.Backoff = backoff
+	}
+}
+
+// WithRetry set the initial delay of retrying accept.
+//
+// Deprecated: use WithBackoff.
 func WithRetry(retry time.Duration) Option {
 	return func(cfg *Config) {
 		cfg.Retry = retry
 	}
 }
 
+// WithBackoffHook set the hook called before the accept loop sleeps for retrying
+func WithBackoffHook(hook func(addr net.Addr, err error, attempt int, delay time.Duration)) Option {
+	return func(cfg *Config) {
+		cfg.BackoffHook = hook
+	}
+}
+
 // NewServer create a new tcp server
 func NewServer(ctx context.Context, opts ...Option) *Server {
 
@@ -58,19 +161,29 @@ func NewServer(ctx context.Context, opts ...Option) *Server {
 		newServer.cfg.MaxConn = 128
 	}
 
-	if newServer.cfg.Timeout == 0 {
-		newServer.cfg.Timeout = 10 * time.Second
+	if newServer.cfg.CloseTimeout == 0 {
+		newServer.cfg.CloseTimeout = 10 * time.Second
 	}
 
-	if newServer.cfg.Retry == 0 {
-		newServer.cfg.Retry = 2 * time.Second
+	newServer.cfg.Backoff = newServer.cfg.Backoff.withDefaults()
+	if retry := newServer.cfg.Retry; retry > 0 {
+		newServer.cfg.Backoff.Initial = retry
+		newServer.cfg.Backoff.Max = max(newServer.cfg.Backoff.Max, retry)
+	}
+
+	if newServer.cfg.RejectHook == nil {
+		newServer.cfg.RejectHook = closeConn
 	}
 
 	if newServer.ctx == nil {
 		newServer.ctx = context.Background()
 	}
 
-	newServer.listeners = make(map[*net.Listener]*Handler, newServer.cfg.MaxConn)
+	newServer.chain = NewChain(Recovery()).Append(newServer.cfg.Middlewares...)
+
+	newServer.listeners = make(map[string]*serveListener, 8)
+	newServer.errCh = make(chan error, 16)
+	newServer.closeCh = make(chan struct{})
 
 	return newServer
 }
@@ -80,12 +193,31 @@ type Server struct {
 
 	ctx context.Context
 
+	// middlewares applied to every handler
+	chain Chain
+
 	// record the number of active client connections on the server
-	connCount uint64
+	connCount atomic.Uint64
+
+	// generate unique client id
+	clientID atomic.Uint64
+
+	clients  map[uint64]*Client
+	clientMu sync.RWMutex
 
 	closed atomic.Bool
 
-	listeners map[*net.Listener]*Handler
+	// listeners keyed by address
+	listeners map[string]*serveListener
+
+	// errors of listeners served in background
+	errCh chan error
+
+	// event loops shared by the listeners served by ServeEvents
+	loops     []*eventLoop
+	loopsOnce sync.Once
+	loopsErr  error
+	nextLoop  atomic.Uint64
 
 	lngroups sync.WaitGroup
 
@@ -94,96 +226,458 @@ type Server struct {
 	closeCh chan struct{}
 }
 
+// ConnCount returns the number of active client connections
+func (s *Server) ConnCount() uint64 {
+	return s.connCount.Load()
+}
+
+// acquireConn reserve a slot for new connection, returns false if the server is full
+func (s *Server) acquireConn() (uint64, bool) {
+	for {
+		n := s.connCount.Load()
+		if n >= s.cfg.MaxConn {
+			return n, false
+		}
+		if s.connCount.CompareAndSwap(n, n+1) {
+			return n + 1, true
+		}
+	}
+}
+
+func (s *Server) releaseConn() {
+	s.connCount.Add(^uint64(0))
+}
+
+func (s *Server) trackClient(client *Client, add bool) {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+
+	if s.clients == nil {
+		s.clients = make(map[uint64]*Client, 128)
+	}
+
+	if add {
+		s.clients[client.ID()] = client
+	} else {
+		delete(s.clients, client.ID())
+	}
+}
+
+// Clients returns all the connected clients
+func (s *Server) Clients() []*Client {
+	s.clientMu.RLock()
+	defer s.clientMu.RUnlock()
+
+	clients := make([]*Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// Client returns the connected client with the specified id
+func (s *Server) Client(id uint64) (*Client, bool) {
+	s.clientMu.RLock()
+	defer s.clientMu.RUnlock()
+	client, ok := s.clients[id]
+	return client, ok
+}
+
+// KillClient closes the client with the specified id, returns false if no such client
+func (s *Server) KillClient(id uint64) bool {
+	client, ok := s.Client(id)
+	if !ok {
+		return false
+	}
+	client.Close()
+	return true
+}
+
+func closeConn(conn net.Conn) {
+	conn.Close()
+}
+
 func (s *Server) isShutdown() bool {
 	return s.closed.Load()
 }
 
+// DrainStats reports how the connections were closed by Shutdown
+type DrainStats struct {
+	// connections finished their in-flight requests and closed gracefully
+	Drained int
+	// connections still busy after the drain window, they were closed forcibly
+	Killed int
+}
+
+// Shutdown stops the server gracefully, see Drain
 func (s *Server) Shutdown() error {
-	if s.isShutdown() {
-		return ErrServerStopped
+	_, err := s.Drain()
+	return err
+}
+
+// Drain stops accepting new connections, closes the idle clients, and lets the busy clients finish their
+// in-flight requests and flush the replies, the clients still busy after CloseTimeout are closed forcibly,
+// finally the handlers are closed.
+func (s *Server) Drain() (DrainStats, error) {
+	// the concurrent calls, e.g. from a signal handler and a listener error, must not close closeCh twice
+	if !s.closed.CompareAndSwap(false, true) {
+		return DrainStats{}, ErrServerStopped
 	}
-	s.closed.Store(true)
+	close(s.closeCh)
 
 	s.mu.Lock()
-	// close listeners and handlers
-	lnerr := s.closeListeners()
+	// close listeners to refuse new connection
+	handlers, lnerr := s.closeListeners()
 	s.mu.Unlock()
 
+	// the event loops will not be started after it
+	s.loopsOnce.Do(func() {})
+
+	deadline := time.Now().Add(s.cfg.CloseTimeout)
+
+	// wait for the accept loops to exit, so no more clients will be registered
 	done := syncx.Wait(func() {
 		s.lngroups.Wait()
 	})
-	defer close(done)
-
-	timer := time.NewTimer(s.cfg.CloseTimeout)
+	timer := time.NewTimer(time.Until(deadline))
 	defer timer.Stop()
 
 	select {
 	case <-done:
-		return lnerr
 	case <-timer.C:
-		return ErrClosedTimeout
+		lnerr = errors2.Join(lnerr, ErrClosedTimeout)
+	}
+
+	loopStats := make(chan DrainStats, 1)
+	go func() {
+		loopStats <- s.stopLoops(deadline)
+	}()
+
+	stats := s.drainClients(deadline)
+	ls := <-loopStats
+	stats.Drained += ls.Drained
+	stats.Killed += ls.Killed
+	logger.Infof("server shutdown: %d connections drained, %d killed", stats.Drained, stats.Killed)
+
+	// how to release the resources depends on the handler's implementation
+	var herr error
+	for _, h := range handlers {
+		herr = errors2.Join(herr, h.Close())
+	}
+
+	return stats, errors2.Join(lnerr, herr)
+}
+
+// drainInterval is how often drainClients checks the remaining clients
+const drainInterval = 20 * time.Millisecond
+
+func (s *Server) drainClients(deadline time.Time) DrainStats {
+	total := len(s.Clients())
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+
+	for {
+		clients := s.Clients()
+		if len(clients) == 0 {
+			return DrainStats{Drained: total}
+		}
+
+		// the idle read may be waken up before its deadline is reset, so drain them on every tick
+		for _, client := range clients {
+			client.drain()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			remaining := s.Clients()
+			for _, client := range remaining {
+				client.Close()
+			}
+			return DrainStats{Drained: total - len(remaining), Killed: len(remaining)}
+		}
+	}
+}
+
+// closeListeners closes all the listeners, and returns their handlers
+func (s *Server) closeListeners() ([]io.Closer, error) {
+	var (
+		err      error
+		handlers []io.Closer
+	)
+	for _, l := range s.listeners {
+		err = errors2.Join(err, l.close())
+		handlers = append(handlers, l.raw)
 	}
+	return handlers, err
 }
 
-func (s *Server) closeListeners() error {
+// serveListener is a logical listener being served by the server, it consists of
+// the listeners bound to the same address, each of them has its own accept loop.
+type serveListener struct {
+	addr net.Addr
+	lns  []net.Listener
+	// the handler passed by user, Handler or EventHandler
+	raw io.Closer
+	// the Handler wrapped by middlewares, nil in event-loop mode
+	handler Handler
+
+	// number of active connections accepted from the listener
+	connCount atomic.Int64
+	// number of accept retries on temporary errors
+	retries atomic.Uint64
+	removed atomic.Bool
+}
+
+func (sl *serveListener) close() error {
 	var err error
-	for l, h := range s.listeners {
-		// close the listener to refuse new connection
-		lerr := (*l).Close()
-		// how to close the exists connections depends on the handler's implementation
-		herr := (*h).Close()
-		err = errors2.Join(herr, lerr)
+	for _, lis := range sl.lns {
+		err = errors2.Join(err, lis.Close())
 	}
 	return err
 }
 
-func (s *Server) trackListener(lis net.Listener, handler Handler, add bool) bool {
+// ListenerInfo describes an active listener of the server
+type ListenerInfo struct {
+	Network string
+	Addr    string
+	// Handler or EventHandler serving the listener
+	Handler   any
+	ConnCount int64
+	// number of accept loops
+	Acceptors int
+	// number of accept retries on temporary errors
+	AcceptRetries uint64
+}
+
+// ListenerError is the error reported by a listener served in background
+type ListenerError struct {
+	Network string
+	Addr    string
+	Err     error
+}
+
+func (l *ListenerError) Error() string {
+	return fmt.Sprintf("coco: %s listener %s: %s", l.Network, l.Addr, l.Err)
+}
+
+func (l *ListenerError) Unwrap() error {
+	return l.Err
+}
+
+// addListener validates and registers the listeners bound to the same address as a logical listener,
+// the logical listeners are identified by their addresses.
+func (s *Server) addListener(lns []net.Listener, handler io.Closer) (*serveListener, error) {
+	if len(lns) == 0 {
+		return nil, errors.Wrap(ErrInvalidListener, "empty")
+	}
+
+	for _, lis := range lns {
+		if lis == nil {
+			return nil, errors.Wrap(ErrInvalidListener, "nil")
+		} else if lis.Addr().String() != lns[0].Addr().String() {
+			return nil, errors.Wrapf(ErrInvalidListener, "different addresses %s and %s", lns[0].Addr(), lis.Addr())
+		}
+	}
+
+	if handler == nil {
+		return nil, errors.Wrap(ErrInvalidHandler, "nil")
+	}
+
+	if network := lns[0].Addr().Network(); network != protocolTCP && network != protocolUnix {
+		handler.Close()
+		for _, lis := range lns {
+			lis.Close()
+		}
+		return nil, errors.Wrap(ErrUnsupportedProtocol, network)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.listeners == nil {
-		s.listeners = make(map[*net.Listener]*Handler, 8)
+	if s.isShutdown() {
+		return nil, ErrServerStopped
 	}
 
-	if add {
-		if s.isShutdown() {
-			return false
-		}
-		s.listeners[&lis] = &handler
-		s.lngroups.Add(1)
+	addr := lns[0].Addr().String()
+	if _, ok := s.listeners[addr]; ok {
+		return nil, errors.Wrap(ErrListenerExists, addr)
+	}
+
+	sl := &serveListener{addr: lns[0].Addr(), lns: lns, raw: handler}
+	if h, ok := handler.(Handler); ok {
+		sl.handler = s.chain.Then(h)
+	}
+	s.listeners[addr] = sl
+	s.lngroups.Add(1)
+	return sl, nil
+}
+
+func (s *Server) deleteListener(sl *serveListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, sl.addr.String())
+	s.lngroups.Done()
+}
+
+// ListenAndServe listens on the tcp or unix address and serves it with handler in background,
+// it returns the actual address, e.g. the port chosen by system for ":0". If Config.ReusePort is
+// greater than 1, that number of tcp listeners are opened on the address with SO_REUSEPORT.
+func (s *Server) ListenAndServe(network, address string, handler Handler) (net.Addr, error) {
+	var (
+		lns []net.Listener
+		err error
+	)
+	if s.cfg.ReusePort > 1 && network != protocolUnix {
+		lns, err = ListenReusePort(network, address, s.cfg.ReusePort)
 	} else {
-		delete(s.listeners, &lis)
-		s.lngroups.Done()
+		var lis net.Listener
+		lis, err = net.Listen(network, address)
+		lns = append(lns, lis)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return true
+	if err := s.AddGroup(lns, handler); err != nil {
+		for _, lis := range lns {
+			lis.Close()
+		}
+		return nil, err
+	}
+	return lns[0].Addr(), nil
 }
 
-// Serve start to accept tcp connections
-func (s *Server) Serve(lis net.Listener, handler Handler) error {
+// Add serves the listener with handler in background, the errors stop serving are reported through Errors.
+func (s *Server) Add(lis net.Listener, handler Handler) error {
+	return s.AddGroup([]net.Listener{lis}, handler)
+}
 
-	if lis == nil {
-		return errors.Wrap(ErrInvalidListener, "nil")
+// AddGroup is the same as Add but serves the listeners bound to the same address as one logical listener,
+// e.g. the listeners opened by ListenReusePort, there is an accept loop for each of them.
+func (s *Server) AddGroup(lns []net.Listener, handler Handler) error {
+	sl, err := s.addListener(lns, handler)
+	if err != nil {
+		return err
 	}
 
-	if handler == nil {
-		return errors.Wrap(ErrInvalidHandler, "nil")
+	s.serveBackground(sl, s.serveConn)
+	return nil
+}
+
+// serveBackground serves the listener in a goroutine, the error stops serving is reported through Errors
+func (s *Server) serveBackground(sl *serveListener, serveConn func(sl *serveListener, conn net.Conn)) {
+	go func() {
+		err := s.serve(sl, serveConn)
+		if errors.Is(err, ErrServerStopped) || errors.Is(err, ErrListenerClosed) {
+			return
+		}
+
+		lerr := &ListenerError{Network: sl.addr.Network(), Addr: sl.addr.String(), Err: err}
+		select {
+		case s.errCh <- lerr:
+		default:
+			logger.Error(lerr)
+		}
+	}()
+}
+
+// Remove stops accepting connections from the listener with the address, the connections accepted
+// from it are still being served. Its handler is not closed since it may be shared by other listeners.
+func (s *Server) Remove(address string) error {
+	s.mu.Lock()
+	sl, ok := s.listeners[address]
+	s.mu.Unlock()
+
+	if !ok {
+		return errors.Wrap(ErrListenerNotFound, address)
 	}
 
-	if lis.Addr().Network() != protocol {
-		handler.Close()
-		lis.Close()
-		return errors.Wrap(ErrUnsupportedProtocol, lis.Addr().Network())
+	sl.removed.Store(true)
+	return sl.close()
+}
+
+// Listeners returns the active listeners
+func (s *Server) Listeners() []ListenerInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]ListenerInfo, 0, len(s.listeners))
+	for _, sl := range s.listeners {
+		infos = append(infos, ListenerInfo{
+			Network:       sl.addr.Network(),
+			Addr:          sl.addr.String(),
+			Handler:       sl.raw,
+			ConnCount:     sl.connCount.Load(),
+			Acceptors:     len(sl.lns),
+			AcceptRetries: sl.retries.Load(),
+		})
 	}
+	return infos
+}
 
-	timeC := 0
+// Errors returns the channel reports the errors of listeners served in background by Add and ListenAndServe,
+// the listener stops serving after its error is reported.
+func (s *Server) Errors() <-chan error {
+	return s.errCh
+}
 
-	if !s.trackListener(lis, handler, true) {
-		return ErrServerStopped
+// Serve start to accept connections from tcp or unix listener, tls listener is also supported
+// because it is built on top of tcp listener. It blocks until the listener is closed.
+func (s *Server) Serve(lis net.Listener, handler Handler) error {
+	sl, err := s.addListener([]net.Listener{lis}, handler)
+	if err != nil {
+		return err
 	}
-	defer s.trackListener(lis, handler, false)
+	return s.serve(sl, s.serveConn)
+}
 
-	logger.Infof("tcp server is listening on %s", lis.Addr().String())
+// serve accepts connections from the listeners until they are closed, the accepted connections are passed to
+// serveConn, which is responsible for calling s.releaseConn and decreasing sl.connCount after the connection ends.
+// If one of the accept loops fails, the others are stopped and the error is returned.
+func (s *Server) serve(sl *serveListener, serveConn func(sl *serveListener, conn net.Conn)) error {
+	defer s.deleteListener(sl)
+
+	if len(sl.lns) == 1 {
+		logger.Infof("%s server is listening on %s", sl.addr.Network(), sl.addr)
+	} else {
+		logger.Infof("%s server is listening on %s with %d acceptors", sl.addr.Network(), sl.addr, len(sl.lns))
+	}
+
+	errs := make(chan error, len(sl.lns))
+	for _, lis := range sl.lns[1:] {
+		go func(lis net.Listener) {
+			errs <- s.accept(sl, lis, serveConn)
+		}(lis)
+	}
+	errs <- s.accept(sl, sl.lns[0], serveConn)
+
+	var serveErr error
+	for range sl.lns {
+		err := <-errs
+		if serveErr == nil {
+			serveErr = err
+			if !errors.Is(err, ErrServerStopped) && !errors.Is(err, ErrListenerClosed) {
+				// stop the other accept loops
+				sl.removed.Store(true)
+				sl.close()
+			}
+		}
+	}
+
+	if errors.Is(serveErr, ErrListenerClosed) {
+		logger.Infof("%s server stopped listening on %s", sl.addr.Network(), sl.addr)
+	}
+	return serveErr
+}
+
+// accept runs the accept loop of a listener
+func (s *Server) accept(sl *serveListener, lis net.Listener, serveConn func(sl *serveListener, conn net.Conn)) error {
+	// consecutive failures
+	attempt := 0
 
 	// handle connection
 	for {
@@ -194,28 +688,76 @@ func (s *Server) Serve(lis net.Listener, handler Handler) error {
 			// while listener is closed, accept will return error immediately
 			if s.isShutdown() {
 				return ErrServerStopped
+			} else if sl.removed.Load() {
+				return ErrListenerClosed
 			}
 
-			var neterr net.Error
-			if errors.As(err, &neterr) && neterr != nil && neterr.Timeout() && timeC < 5 {
-				logger.Warnf("connect timeout, retry in %s later", s.cfg.Retry.String())
-				time.Sleep(s.cfg.Retry)
-				timeC++
-				continue
+			attempt++
+			if !isTemporary(err) || s.cfg.Backoff.MaxRetries > 0 && attempt > s.cfg.Backoff.MaxRetries {
+				return err
 			}
-			return err
-		}
 
-		s.connCount++
-		logger.Infof("[%d] remote connection established: %s", s.connCount, conn.RemoteAddr())
+			delay := s.cfg.Backoff.Delay(attempt)
+			sl.retries.Add(1)
+			logger.Warnf("accept on %s failed: %s, retry in %s (attempt %d)", lis.Addr(), err, delay, attempt)
+			if s.cfg.BackoffHook != nil {
+				s.cfg.BackoffHook(lis.Addr(), err, attempt, delay)
+			}
 
-		go func() {
-			defer func() {
-				s.mu.Lock()
-				s.connCount--
-				s.mu.Unlock()
+			// wake up early on shutdown
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-s.closeCh:
+				timer.Stop()
+			}
+			continue
+		}
+		attempt = 0
+
+		count, ok := s.acquireConn()
+		if !ok {
+			logger.Warnf("max number of clients reached (%d), reject %s", count, conn.RemoteAddr())
+			go func() {
+				defer conn.Close()
+				s.cfg.RejectHook(conn)
 			}()
-			handler.Handle(s.ctx, conn)
-		}()
+			continue
+		}
+		logger.Infof("[%d] remote connection established: %s", count, conn.RemoteAddr())
+
+		if err := setKeepAlive(conn, s.cfg.KeepAlive); err != nil {
+			logger.Warnf("set keepalive for %s failed: %s", conn.RemoteAddr(), err)
+		}
+
+		sl.connCount.Add(1)
+		serveConn(sl, conn)
 	}
 }
+
+// serveConn serves the connection with a new goroutine
+func (s *Server) serveConn(sl *serveListener, conn net.Conn) {
+	client := newClient(s.ctx, s.clientID.Add(1), newTimeoutConn(conn, s.cfg))
+	s.trackClient(client, true)
+
+	go func() {
+		defer s.releaseConn()
+		defer sl.connCount.Add(-1)
+		defer s.trackClient(client, false)
+		// the connection ends with Handle
+		defer client.Close()
+
+		// the real client address is known after reading the PROXY protocol header
+		if pc := proxyConnOf(conn); pc != nil {
+			if err := pc.ReadHeader(); err != nil {
+				logger.Warnf("reject %s: %s", pc.UpstreamAddr(), err)
+				return
+			}
+			if pc.Version() > 0 {
+				logger.Infof("client %d %s is proxied by %s", client.ID(), pc.RemoteAddr(), pc.UpstreamAddr())
+			}
+		}
+
+		sl.handler.Handle(client.Context(), client)
+	}()
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/246859/codis/coco"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoff_Delay(t *testing.T) {
+	backoff := coco.Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2}
+	expected := []time.Duration{10, 20, 40, 50, 50}
+	for i, d := range expected {
+		if delay := backoff.Delay(i + 1); delay != d*time.Millisecond {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, d*time.Millisecond, delay)
+		}
+	}
+
+	// zero values use the defaults
+	if delay := (coco.Backoff{}).Delay(1); delay != 5*time.Millisecond {
+		t.Errorf("expected default initial delay 5ms, got %s", delay)
+	}
+	if delay := (coco.Backoff{}).Delay(100); delay != time.Second {
+		t.Errorf("expected default max delay 1s, got %s", delay)
+	}
+}
+
+// scriptListener returns the scripted errors from Accept in order, nil means accepting a real connection
+type scriptListener struct {
+	net.Listener
+	mu     sync.Mutex
+	script []error
+}
+
+func (s *scriptListener) Accept() (net.Conn, error) {
+	s.mu.Lock()
+	var err error
+	if len(s.script) > 0 {
+		err, s.script = s.script[0], s.script[1:]
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept4", err)}
+	}
+	return s.Listener.Accept()
+}
+
+func repeatErr(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+func TestServer_AcceptBackoff(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts []int
+	)
+	server := coco.NewServer(context.Background(),
+		coco.WithCloseTimeout(time.Second),
+		coco.WithBackoff(coco.Backoff{Initial: time.Millisecond, Max: 4 * time.Millisecond}),
+		coco.WithBackoffHook(func(addr net.Addr, err error, attempt int, delay time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, attempt)
+		}),
+	)
+	defer server.Shutdown()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := append(repeatErr(syscall.EMFILE, 8), nil)
+	script = append(script, repeatErr(syscall.ECONNABORTED, 3)...)
+	if err := server.Add(&scriptListener{Listener: lis, script: script}, &coco.CocoHandler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the listener survives the burst of fd exhaustion
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		echo(t, conn)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []int{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3}
+	if len(attempts) != len(expected) {
+		t.Fatalf("expected attempts %v, got %v", expected, attempts)
+	}
+	for i := range expected {
+		if attempts[i] != expected[i] {
+			t.Fatalf("expected attempts %v, got %v", expected, attempts)
+		}
+	}
+
+	if infos := server.Listeners(); len(infos) != 1 || infos[0].AcceptRetries != 11 {
+		t.Errorf("expected 11 accept retries, got %+v", infos)
+	}
+}
+
+func TestServer_AcceptRetry(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		delays []time.Duration
+	)
+	server := coco.NewServer(context.Background(),
+		coco.WithCloseTimeout(time.Second),
+		coco.WithBackoff(coco.Backoff{Max: 4 * time.Millisecond}),
+		coco.WithRetry(20*time.Millisecond),
+		coco.WithBackoffHook(func(addr net.Addr, err error, attempt int, delay time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			delays = append(delays, delay)
+		}),
+	)
+	defer server.Shutdown()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Add(&scriptListener{Listener: lis, script: []error{syscall.EMFILE}}, &coco.CocoHandler{}); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+
+	// the deprecated retry is the initial delay, and it raises the smaller max
+	mu.Lock()
+	defer mu.Unlock()
+	if len(delays) != 1 || delays[0] != 20*time.Millisecond {
+		t.Errorf("expected delays [20ms], got %v", delays)
+	}
+}
+
+func TestServer_AcceptMaxRetries(t *testing.T) {
+	server := coco.NewServer(context.Background(),
+		coco.WithCloseTimeout(time.Second),
+		coco.WithBackoff(coco.Backoff{Initial: time.Millisecond, MaxRetries: 3}),
+	)
+	defer server.Shutdown()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	err = server.Serve(&scriptListener{Listener: lis, script: repeatErr(syscall.ENFILE, 4)}, &coco.CocoHandler{})
+	if !errors.Is(err, syscall.ENFILE) {
+		t.Errorf("expected to give up with ENFILE, got %v", err)
+	}
+}
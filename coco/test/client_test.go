@@ -0,0 +1,96 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"github.com/246859/codis/coco"
+	"net"
+	"testing"
+	"time"
+)
+
+// ctxHandler echoes a line with the client id, and records whether the client context is cancelled
+type ctxHandler struct {
+	cancelled chan uint64
+}
+
+func (c *ctxHandler) Handle(ctx context.Context, client *coco.Client) {
+	client.SetName("test")
+	reader := bufio.NewReader(client)
+	go func() {
+		<-ctx.Done()
+		c.cancelled <- client.ID()
+	}()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		client.SetLastCommand(line[:len(line)-1])
+		client.Write([]byte(line))
+	}
+}
+
+func (c *ctxHandler) Close() error {
+	return nil
+}
+
+func TestServer_Clients(t *testing.T) {
+	server := coco.NewServer(context.Background(), coco.WithCloseTimeout(time.Second))
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &ctxHandler{cancelled: make(chan uint64, 2)}
+	go server.Serve(listen, handler)
+	defer server.Shutdown()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listen.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("ping\n"))
+		bufio.NewReader(conn).ReadString('\n')
+	}
+
+	clients := server.Clients()
+	if len(clients) != 2 {
+		t.Fatalf("expected 2 clients, got %d", len(clients))
+	}
+	if clients[0].ID() == clients[1].ID() {
+		t.Error("expected unique client ids")
+	}
+
+	client := clients[0]
+	if cmd, at := client.LastCommand(); cmd != "ping" || at.IsZero() {
+		t.Errorf("unexpected last command %q at %s", cmd, at)
+	}
+	if client.Name() != "test" || client.CreatedAt().IsZero() || client.LocalAddr().String() != listen.Addr().String() {
+		t.Errorf("unexpected client %d %s %s", client.ID(), client.Name(), client.LocalAddr())
+	}
+
+	if !server.KillClient(client.ID()) {
+		t.Fatal("expected client killed")
+	}
+	select {
+	case id := <-handler.cancelled:
+		if id != client.ID() {
+			t.Errorf("expected client %d cancelled, got %d", client.ID(), id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected client context cancelled")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(server.Clients()) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := server.Client(client.ID()); ok {
+		t.Error("expected killed client removed from registry")
+	}
+	if server.KillClient(client.ID()) {
+		t.Error("expected no such client")
+	}
+}
@@ -36,3 +36,162 @@ func TestCocoHandler_Handle(t *testing.T) {
 	server.Shutdown()
 	time.Sleep(2 * time.Second)
 }
+
+func TestServer_MaxConn(t *testing.T) {
+	server := coco.NewServer(context.Background(),
+		coco.WithMaxConn(2),
+		coco.WithCloseTimeout(time.Second),
+		coco.WithRejectHook(func(conn net.Conn) {
+			conn.Write([]byte("-ERR max number of clients reached\r\n"))
+			conn.Close()
+		}),
+	)
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listen, &coco.CocoHandler{})
+	defer server.Shutdown()
+
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listen.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		// make sure the connection has been accepted and is being handled
+		conn.Write([]byte("ping\n"))
+		if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+
+	if count := server.ConnCount(); count != 2 {
+		t.Errorf("expected 2 connections, got %d", count)
+	}
+
+	rejected, err := net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejected.Close()
+	reply, _ := bufio.NewReader(rejected).ReadString('\n')
+	if reply != "-ERR max number of clients reached\r\n" {
+		t.Errorf("unexpected reply %q", reply)
+	}
+
+	// the slot is released after a client disconnects
+	conns[0].Close()
+	deadline := time.Now().Add(time.Second)
+	for server.ConnCount() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := server.ConnCount(); count != 1 {
+		t.Errorf("expected 1 connection, got %d", count)
+	}
+}
+
+func TestServer_SlowRejectHook(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	server := coco.NewServer(context.Background(),
+		coco.WithMaxConn(1),
+		coco.WithCloseTimeout(time.Second),
+		coco.WithRejectHook(func(conn net.Conn) {
+			// a client which does not read its reply
+			close(started)
+			<-release
+		}),
+	)
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listen, &coco.CocoHandler{})
+	defer server.Shutdown()
+	defer close(release)
+
+	conn, err := net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("ping\n"))
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	rejected, err := net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejected.Close()
+	<-started
+
+	// free the slot while the hook is still running
+	conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for server.ConnCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	next, err := net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	next.SetDeadline(time.Now().Add(time.Second))
+	next.Write([]byte("ping\n"))
+	if reply, err := bufio.NewReader(next).ReadString('\n'); err != nil || reply != "ping\n" {
+		t.Fatalf("expected the next client to be served while the hook is blocked, got %q %v", reply, err)
+	}
+}
+
+func TestServer_Timeout(t *testing.T) {
+	server := coco.NewServer(context.Background(),
+		coco.WithTimeout(300*time.Millisecond),
+		coco.WithReadTimeout(50*time.Millisecond),
+		coco.WithKeepAlive(time.Minute),
+		coco.WithCloseTimeout(time.Second),
+	)
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listen, &coco.CocoHandler{})
+	defer server.Shutdown()
+
+	closedAfter := func(conn net.Conn, send string) time.Duration {
+		start := time.Now()
+		if send != "" {
+			conn.Write([]byte(send))
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		reader := bufio.NewReader(conn)
+		for {
+			if _, err := reader.ReadString('\n'); err != nil {
+				return time.Since(start)
+			}
+		}
+	}
+
+	// idle client is closed after the idle timeout
+	idle, err := net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	if d := closedAfter(idle, ""); d < 250*time.Millisecond || d > time.Second {
+		t.Errorf("expected idle client closed after about 300ms, got %s", d)
+	}
+
+	// client stalls in the middle of a request is closed after the read timeout
+	stalled, err := net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	if d := closedAfter(stalled, "partial"); d > 250*time.Millisecond {
+		t.Errorf("expected stalled client closed after about 50ms, got %s", d)
+	}
+}
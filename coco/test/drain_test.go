@@ -0,0 +1,155 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/246859/codis/coco"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowHandler echoes the lines, the line starts with "slow" is replied after a while
+type slowHandler struct{}
+
+func (s slowHandler) Handle(ctx context.Context, client *coco.Client) {
+	reader := bufio.NewReader(client)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(line, "slow") {
+			time.Sleep(200 * time.Millisecond)
+		}
+		if _, err := client.Write([]byte(line)); err != nil {
+			return
+		}
+	}
+}
+
+func (s slowHandler) Close() error {
+	return nil
+}
+
+func TestServer_Drain(t *testing.T) {
+	server := coco.NewServer(context.Background(), coco.WithCloseTimeout(500*time.Millisecond))
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listen, slowHandler{})
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", listen.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		echo(t, conn)
+		return conn
+	}
+
+	idle := dial()
+	busy := dial()
+	stalled := dial()
+
+	busy.Write([]byte("slow\n"))
+	stalled.Write([]byte("partial"))
+	// make sure the requests have been received
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	stats, err := server.Drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Drained != 2 || stats.Killed != 1 {
+		t.Errorf("expected 2 drained and 1 killed, got %+v", stats)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond || d > time.Second {
+		t.Errorf("expected shutdown after the drain window, got %s", d)
+	}
+
+	// the in-flight request is replied before closing
+	reader := bufio.NewReader(busy)
+	if reply, err := reader.ReadString('\n'); err != nil || reply != "slow\n" {
+		t.Errorf("expected in-flight reply, got %q %v", reply, err)
+	}
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("expected busy client closed, got %v", err)
+	}
+	if _, err := bufio.NewReader(idle).ReadString('\n'); err != io.EOF {
+		t.Errorf("expected idle client closed, got %v", err)
+	}
+
+	if _, err := server.Drain(); err != coco.ErrServerStopped {
+		t.Errorf("expected server stopped, got %v", err)
+	}
+}
+
+func TestServer_DrainIdle(t *testing.T) {
+	server := coco.NewServer(context.Background(), coco.WithTimeout(time.Minute), coco.WithReadTimeout(time.Minute))
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listen, slowHandler{})
+
+	for i := 0; i < 5; i++ {
+		conn, err := net.Dial("tcp", listen.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		echo(t, conn)
+	}
+
+	// idle clients do not wait for the drain window
+	start := time.Now()
+	stats, err := server.Drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Drained != 5 || stats.Killed != 0 {
+		t.Errorf("expected 5 drained, got %+v", stats)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected idle clients closed immediately, got %s", d)
+	}
+}
+
+func TestServer_ConcurrentShutdown(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		server := coco.NewServer(context.Background(), coco.WithCloseTimeout(time.Second))
+		if _, err := server.ListenAndServe("tcp", "127.0.0.1:0", slowHandler{}); err != nil {
+			t.Fatal(err)
+		}
+
+		const callers = 8
+		errs := make(chan error, callers)
+		start := make(chan struct{})
+		for j := 0; j < callers; j++ {
+			go func() {
+				<-start
+				errs <- server.Shutdown()
+			}()
+		}
+		close(start)
+
+		stopped := 0
+		for j := 0; j < callers; j++ {
+			if err := <-errs; errors.Is(err, coco.ErrServerStopped) {
+				stopped++
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if stopped != callers-1 {
+			t.Fatalf("expected exactly one shutdown to succeed, %d of %d returned ErrServerStopped", stopped, callers)
+		}
+	}
+}
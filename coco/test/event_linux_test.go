@@ -0,0 +1,106 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/246859/codis/coco"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// anonFds returns the descriptors of the anonymous inode kind, e.g. "[eventpoll]" or "[eventfd]"
+func anonFds(t *testing.T, kind string) map[int]bool {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip(err)
+	}
+	fds := make(map[int]bool)
+	for _, entry := range entries {
+		fd, _ := strconv.Atoi(entry.Name())
+		if link, err := os.Readlink("/proc/self/fd/" + entry.Name()); err == nil && link == "anon_inode:"+kind {
+			fds[fd] = true
+		}
+	}
+	return fds
+}
+
+// newFd returns the only descriptor in after but not in before
+func newFd(t *testing.T, before, after map[int]bool) int {
+	fd := -1
+	for n := range after {
+		if !before[n] {
+			if fd >= 0 {
+				t.Skip("more than one new descriptor")
+			}
+			fd = n
+		}
+	}
+	if fd < 0 {
+		t.Fatal("no new descriptor")
+	}
+	return fd
+}
+
+func TestServer_StopAfterLoopExited(t *testing.T) {
+	epolls, eventfds := anonFds(t, "[eventpoll]"), anonFds(t, "[eventfd]")
+	server := coco.NewServer(context.Background(), coco.WithEventLoops(1))
+	listen := serveEvents(t, server, &echoEvents{})
+	epfd := newFd(t, epolls, anonFds(t, "[eventpoll]"))
+	wakefd := newFd(t, eventfds, anonFds(t, "[eventfd]"))
+
+	// epoll_wait fails once the epoll descriptor is replaced by a regular file
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	if err := unix.Dup2(int(null.Fd()), epfd); err != nil {
+		t.Fatal(err)
+	}
+	// wake up the loop by a connection
+	conn, err := net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for anonFds(t, "[eventfd]")[wakefd] && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if anonFds(t, "[eventfd]")[wakefd] {
+		t.Fatal("expected the loop exited and released")
+	}
+
+	// the number of wakefd is reused by a socket, which must not receive anything from the stopped loop
+	var peer int
+	for i := 0; ; i++ {
+		pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unix.Close(pair[0])
+		defer unix.Close(pair[1])
+		if pair[0] == wakefd {
+			peer = pair[1]
+			break
+		} else if pair[1] == wakefd {
+			peer = pair[0]
+			break
+		} else if i == 64 {
+			t.Skip("the number of wakefd is taken by another file")
+		}
+	}
+
+	if _, err := server.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	var buf [8]byte
+	if n, err := unix.Read(peer, buf[:]); !errors.Is(err, unix.EAGAIN) {
+		t.Errorf("expected nothing written into the reused descriptor, got %q %v", buf[:max(n, 0)], err)
+	}
+}
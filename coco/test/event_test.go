@@ -0,0 +1,369 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/246859/codis/coco"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// echoEvents echoes the complete lines, "quit" closes the connection and "bad" returns an error
+type echoEvents struct {
+	opened atomic.Int64
+	closed chan error
+}
+
+func (e *echoEvents) OnOpen(conn *coco.EventConn) {
+	e.opened.Add(1)
+}
+
+func (e *echoEvents) OnData(conn *coco.EventConn, data []byte) (int, error) {
+	consumed := 0
+	for {
+		i := bytes.IndexByte(data[consumed:], '\n')
+		if i < 0 {
+			return consumed, nil
+		}
+		line := data[consumed : consumed+i+1]
+		consumed += i + 1
+
+		switch string(line) {
+		case "quit\n":
+			conn.Write([]byte("bye\n"))
+			conn.Close()
+			return consumed, nil
+		case "bad\n":
+			return consumed, errors.New("bad request")
+		}
+		conn.Write(line)
+	}
+}
+
+func (e *echoEvents) OnClose(conn *coco.EventConn, err error) {
+	if e.closed != nil {
+		e.closed <- err
+	}
+}
+
+func (e *echoEvents) Close() error {
+	return nil
+}
+
+func serveEvents(t testing.TB, server *coco.Server, handler coco.EventHandler) net.Listener {
+	if runtime.GOOS != "linux" {
+		t.Skip("event-loop mode is only supported on linux")
+	}
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeEvents(listen, handler)
+	// wait for the listener being served
+	deadline := time.Now().Add(time.Second)
+	for len(server.Listeners()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return listen
+}
+
+func TestServer_ServeEvents(t *testing.T) {
+	server := coco.NewServer(context.Background(), coco.WithEventLoops(2), coco.WithCloseTimeout(300*time.Millisecond))
+	handler := &echoEvents{closed: make(chan error, 64)}
+	listen := serveEvents(t, server, handler)
+
+	var conns []net.Conn
+	for i := 0; i < 10; i++ {
+		conn, err := net.Dial("tcp", listen.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		echo(t, conn)
+		conns = append(conns, conn)
+	}
+	if count := server.ConnCount(); count != 10 {
+		t.Errorf("expected 10 connections, got %d", count)
+	}
+	if opened := handler.opened.Load(); opened != 10 {
+		t.Errorf("expected 10 opened, got %d", opened)
+	}
+
+	// the incomplete input is kept until the rest arrives, and the pipelined lines are replied in order
+	conns[0].Write([]byte("hel"))
+	time.Sleep(20 * time.Millisecond)
+	conns[0].Write([]byte("lo\nworld\n"))
+	reader := bufio.NewReader(conns[0])
+	for _, expected := range []string{"hello\n", "world\n"} {
+		if reply, err := reader.ReadString('\n'); err != nil || reply != expected {
+			t.Errorf("expected %q, got %q %v", expected, reply, err)
+		}
+	}
+
+	// the reply is written before closing
+	conns[1].Write([]byte("quit\n"))
+	reader = bufio.NewReader(conns[1])
+	if reply, _ := reader.ReadString('\n'); reply != "bye\n" {
+		t.Errorf("expected bye, got %q", reply)
+	}
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("expected closed, got %v", err)
+	}
+	if err := <-handler.closed; err != nil {
+		t.Errorf("expected closed without error, got %v", err)
+	}
+
+	conns[2].Write([]byte("bad\n"))
+	if err := <-handler.closed; err == nil || err.Error() != "bad request" {
+		t.Errorf("expected handler error, got %v", err)
+	}
+
+	// closed by peer
+	conns[3].Close()
+	if err := <-handler.closed; err != nil {
+		t.Errorf("expected closed without error, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for server.ConnCount() != 7 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if infos := server.Listeners(); len(infos) != 1 || infos[0].ConnCount != 7 {
+		t.Errorf("expected 7 connections on listener, got %+v", infos)
+	}
+
+	// the connection with incomplete input is killed after the drain window
+	conns[4].Write([]byte("partial"))
+	time.Sleep(20 * time.Millisecond)
+
+	stats, err := server.Drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Drained != 6 || stats.Killed != 1 {
+		t.Errorf("expected 6 drained and 1 killed, got %+v", stats)
+	}
+	if count := server.ConnCount(); count != 0 {
+		t.Errorf("expected no connections, got %d", count)
+	}
+}
+
+func TestServer_ServeEventsTimeout(t *testing.T) {
+	server := coco.NewServer(context.Background(), coco.WithEventLoops(1), coco.WithTimeout(500*time.Millisecond))
+	defer server.Shutdown()
+	handler := &echoEvents{closed: make(chan error, 1)}
+	listen := serveEvents(t, server, handler)
+
+	conn, err := net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+
+	select {
+	case err := <-handler.closed:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("expected idle connection closed")
+	}
+}
+
+func TestServer_ServeEventsDrainWhileAccepting(t *testing.T) {
+	server := coco.NewServer(context.Background(), coco.WithEventLoops(2), coco.WithMaxConn(1<<20))
+	listen := serveEvents(t, server, &echoEvents{})
+
+	var (
+		wg   sync.WaitGroup
+		stop atomic.Bool
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100 && !stop.Load(); j++ {
+				conn, err := net.Dial("tcp", listen.Addr().String())
+				if err != nil {
+					continue
+				}
+				defer conn.Close()
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := server.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	// the connections queued for the loops when they stop are closed and uncounted too
+	deadline := time.Now().Add(time.Second)
+	for server.ConnCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := server.ConnCount(); count != 0 {
+		t.Errorf("expected no connections, got %d", count)
+	}
+}
+
+// panicEvents panics when the connections are closed
+type panicEvents struct {
+	echoEvents
+}
+
+func (p *panicEvents) OnClose(conn *coco.EventConn, err error) {
+	panic("close")
+}
+
+func TestServer_ServeEventsPanicOnClose(t *testing.T) {
+	server := coco.NewServer(context.Background(), coco.WithEventLoops(1))
+	defer server.Shutdown()
+	listen := serveEvents(t, server, &panicEvents{})
+
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", listen.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the loop keeps serving after the panic of the previous connection
+		echo(t, conn)
+		conn.Close()
+
+		deadline := time.Now().Add(time.Second)
+		for server.ConnCount() != 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if count := server.ConnCount(); count != 0 {
+			t.Fatalf("expected the connection uncounted, got %d", count)
+		}
+	}
+}
+
+// lineHandler echoes the lines in goroutine-per-connection mode
+type lineHandler struct{}
+
+func (l lineHandler) Handle(ctx context.Context, client *coco.Client) {
+	reader := bufio.NewReader(client)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err != nil {
+			return
+		}
+		if _, err := client.Write(line); err != nil {
+			return
+		}
+	}
+}
+
+func (l lineHandler) Close() error {
+	return nil
+}
+
+// benchServer starts a server in the mode and returns the address
+func benchServer(b *testing.B, mode string) (*coco.Server, string) {
+	server := coco.NewServer(context.Background(), coco.WithMaxConn(1<<20), coco.WithCloseTimeout(time.Second))
+	if mode == "eventloop" {
+		return server, serveEvents(b, server, &echoEvents{}).Addr().String()
+	}
+
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	go server.Serve(listen, lineHandler{})
+	return server, listen.Addr().String()
+}
+
+func BenchmarkServe_Echo(b *testing.B) {
+	for _, mode := range []string{"goroutine", "eventloop"} {
+		b.Run(mode, func(b *testing.B) {
+			server, addr := benchServer(b, mode)
+			defer server.Shutdown()
+
+			const clients = 64
+			var (
+				wg   sync.WaitGroup
+				reqs atomic.Int64
+			)
+			reqs.Store(int64(b.N))
+
+			b.ResetTimer()
+			for i := 0; i < clients; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					conn, err := net.Dial("tcp", addr)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					defer conn.Close()
+					reader := bufio.NewReader(conn)
+					for reqs.Add(-1) >= 0 {
+						conn.Write([]byte("ping\n"))
+						if _, err := reader.ReadSlice('\n'); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// BenchmarkServe_IdleConns reports the memory used by the idle connections, the client side is included,
+// which costs the same in both modes.
+func BenchmarkServe_IdleConns(b *testing.B) {
+	const conns = 2000
+	for _, mode := range []string{"goroutine", "eventloop"} {
+		b.Run(mode, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				server, addr := benchServer(b, mode)
+
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				clients := make([]net.Conn, 0, conns)
+				for j := 0; j < conns; j++ {
+					conn, err := net.Dial("tcp", addr)
+					if err != nil {
+						b.Fatal(err)
+					}
+					// make sure the connection is being served
+					fmt.Fprint(conn, "ping\n")
+					if _, err := bufio.NewReaderSize(conn, 16).ReadSlice('\n'); err != nil {
+						b.Fatal(err)
+					}
+					clients = append(clients, conn)
+				}
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				used := (after.HeapInuse + after.StackInuse) - (before.HeapInuse + before.StackInuse)
+				b.ReportMetric(float64(used)/conns, "B/conn")
+				b.ReportMetric(float64(runtime.NumGoroutine()), "goroutines")
+
+				for _, conn := range clients {
+					conn.Close()
+				}
+				server.Shutdown()
+			}
+		})
+	}
+}
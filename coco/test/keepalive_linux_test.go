@@ -0,0 +1,104 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/246859/codis/coco"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// keepAliveHandler replies the TCP_KEEPIDLE seconds of the server side socket for every line
+type keepAliveHandler struct{}
+
+func (k keepAliveHandler) Handle(ctx context.Context, client *coco.Client) {
+	reader := bufio.NewReader(client)
+	for {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return
+		}
+		fmt.Fprintf(client, "%d\n", keepIdle(client.Conn))
+	}
+}
+
+func (k keepAliveHandler) Close() error {
+	return nil
+}
+
+// keepIdle returns TCP_KEEPIDLE of the tcp connection under conn, -1 if it is not found
+func keepIdle(conn net.Conn) int {
+	for {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			raw, err := tcpConn.SyscallConn()
+			if err != nil {
+				return -1
+			}
+			idle := -1
+			raw.Control(func(fd uintptr) {
+				idle, _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)
+			})
+			return idle
+		}
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return -1
+		}
+		conn = wrapper.NetConn()
+	}
+}
+
+func TestKeepAlive_TLS(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir())
+	lis, err := coco.ListenTLS("127.0.0.1:0", coco.TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// differs from the default period of go
+	server := coco.NewServer(context.Background(), coco.WithCloseTimeout(time.Second), coco.WithKeepAlive(37*time.Second))
+	go server.Serve(lis, keepAliveHandler{})
+	defer server.Shutdown()
+
+	pemBytes, _ := os.ReadFile(certFile)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pemBytes)
+	conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	conn.Write([]byte("idle\n"))
+	if reply, err := bufio.NewReader(conn).ReadString('\n'); err != nil || reply != "37\n" {
+		t.Errorf("expected keepalive period 37s on tls connection, got %q %v", reply, err)
+	}
+}
+
+func TestKeepAlive_Proxy(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxied, err := coco.NewProxyListener(lis, coco.ProxyConfig{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := coco.NewServer(context.Background(), coco.WithCloseTimeout(time.Second), coco.WithKeepAlive(37*time.Second))
+	go server.Serve(proxied, keepAliveHandler{})
+	defer server.Shutdown()
+
+	for _, data := range []string{"PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\nidle\n", "idle\n"} {
+		reply, err := send(t, lis.Addr().String(), []byte(data))
+		if err != nil || reply != "37\n" {
+			t.Errorf("%q: expected keepalive period 37s behind proxy listener, got %q %v", data, reply, err)
+		}
+	}
+}
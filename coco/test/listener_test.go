@@ -0,0 +1,337 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/246859/codis/coco"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func echo(t *testing.T, conn net.Conn) {
+	t.Helper()
+	if _, err := conn.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello\n" {
+		t.Errorf("unexpected reply %q", reply)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "codis.sock")
+
+	// leave a stale socket file like a crashed process
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	lis, err := coco.ListenUnix(path, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("expected permissions 0700, got %o", info.Mode().Perm())
+	}
+
+	// the socket is in use
+	if _, err := coco.ListenUnix(path, 0700); !errors.Is(err, coco.ErrSocketInUse) {
+		t.Errorf("expected socket in use, got %v", err)
+	}
+
+	server := coco.NewServer(context.Background(), coco.WithCloseTimeout(time.Second))
+	go server.Serve(lis, &coco.CocoHandler{})
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+
+	if err := server.Shutdown(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected socket file removed after shutdown, got %v", err)
+	}
+}
+
+// writeCert generates a self-signed certificate for 127.0.0.1
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "codis"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestListenTLS(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir())
+
+	lis, err := coco.ListenTLS("127.0.0.1:0", coco.TLSConfig{
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		CAFile:      certFile,
+		AuthClients: "yes",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := coco.NewServer(context.Background(), coco.WithCloseTimeout(time.Second))
+	go server.Serve(lis, &coco.CocoHandler{})
+	defer server.Shutdown()
+
+	pemBytes, _ := os.ReadFile(certFile)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pemBytes)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+
+	// client without certificate is rejected
+	noCert, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{RootCAs: pool})
+	if err == nil {
+		defer noCert.Close()
+		noCert.Write([]byte("hello\n"))
+		if _, err := bufio.NewReader(noCert).ReadString('\n'); err == nil {
+			t.Error("expected client without certificate rejected")
+		}
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir())
+
+	if _, err := coco.NewTLSConfig(coco.TLSConfig{CertFile: certFile}); !errors.Is(err, coco.ErrMissingCerts) {
+		t.Errorf("expected missing certs, got %v", err)
+	}
+	if _, err := coco.NewTLSConfig(coco.TLSConfig{CertFile: certFile, KeyFile: keyFile, AuthClients: "yes"}); !errors.Is(err, coco.ErrMissingCA) {
+		t.Errorf("expected missing CA, got %v", err)
+	}
+	if _, err := coco.NewTLSConfig(coco.TLSConfig{CertFile: certFile, KeyFile: keyFile, AuthClients: "maybe"}); !errors.Is(err, coco.ErrInvalidAuth) {
+		t.Errorf("expected invalid auth, got %v", err)
+	}
+	if _, err := coco.NewTLSConfig(coco.TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: keyFile, AuthClients: "optional"}); !errors.Is(err, coco.ErrInvalidCA) {
+		t.Errorf("expected invalid CA, got %v", err)
+	}
+}
+
+// brokenListener fails on Accept
+type brokenListener struct {
+	net.Listener
+}
+
+func (b brokenListener) Accept() (net.Conn, error) {
+	return nil, errors.New("broken")
+}
+
+func TestServer_Listeners(t *testing.T) {
+	server := coco.NewServer(context.Background(), coco.WithCloseTimeout(time.Second))
+	defer server.Shutdown()
+
+	public, admin := &coco.CocoHandler{}, &coco.CocoHandler{}
+	publicAddr, err := server.ListenAndServe("tcp", "127.0.0.1:0", public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminAddr, err := server.ListenAndServe("tcp", "127.0.0.1:0", admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := server.ListenAndServe("tcp", publicAddr.String(), public); err == nil {
+		t.Error("expected address in use")
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	if err := server.Add(lis, public); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Add(lis, public); !errors.Is(err, coco.ErrListenerExists) {
+		t.Errorf("expected listener exists, got %v", err)
+	}
+	if err := server.Remove(lis.Addr().String()); err != nil {
+		t.Error(err)
+	}
+
+	conn, err := net.Dial("tcp", publicAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+
+	infos := server.Listeners()
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(infos))
+	}
+	for _, info := range infos {
+		switch info.Addr {
+		case publicAddr.String():
+			if info.ConnCount != 1 || info.Handler != coco.Handler(public) || info.Network != "tcp" {
+				t.Errorf("unexpected public listener %+v", info)
+			}
+		case adminAddr.String():
+			if info.ConnCount != 0 || info.Handler != coco.Handler(admin) {
+				t.Errorf("unexpected admin listener %+v", info)
+			}
+		default:
+			t.Errorf("unexpected listener %s", info.Addr)
+		}
+	}
+
+	// the removed listener refuses new connections, the accepted ones are still served
+	if err := server.Remove(publicAddr.String()); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(server.Listeners()) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := net.Dial("tcp", publicAddr.String()); err == nil {
+		t.Error("expected removed listener refuses connections")
+	}
+	echo(t, conn)
+	if infos := server.Listeners(); len(infos) != 1 || infos[0].Addr != adminAddr.String() {
+		t.Errorf("expected only admin listener, got %+v", infos)
+	}
+	if err := server.Remove(publicAddr.String()); !errors.Is(err, coco.ErrListenerNotFound) {
+		t.Errorf("expected listener not found, got %v", err)
+	}
+
+	// the error of background listener is reported
+	broken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broken.Close()
+	if err := server.Add(brokenListener{broken}, admin); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-server.Errors():
+		var lerr *coco.ListenerError
+		if !errors.As(err, &lerr) || lerr.Addr != broken.Addr().String() || lerr.Err.Error() != "broken" {
+			t.Errorf("unexpected listener error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected listener error reported")
+	}
+}
+
+func TestServer_ReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT is only supported on linux")
+	}
+
+	server := coco.NewServer(context.Background(), coco.WithReusePort(4), coco.WithCloseTimeout(time.Second))
+	addr, err := server.ListenAndServe("tcp", "127.0.0.1:0", &coco.CocoHandler{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos := server.Listeners()
+	if len(infos) != 1 || infos[0].Addr != addr.String() || infos[0].Acceptors != 4 {
+		t.Fatalf("expected one logical listener with 4 acceptors, got %+v", infos)
+	}
+
+	for i := 0; i < 20; i++ {
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		echo(t, conn)
+	}
+	if count := server.ConnCount(); count != 20 {
+		t.Errorf("expected 20 connections, got %d", count)
+	}
+
+	// the listeners of a group must be bound to the same address
+	lns, err := coco.ListenReusePort("tcp", "127.0.0.1:0", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lns[0].Close()
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := server.AddGroup([]net.Listener{lns[0], other}, &coco.CocoHandler{}); !errors.Is(err, coco.ErrInvalidListener) {
+		t.Errorf("expected invalid listener, got %v", err)
+	}
+
+	if err := server.Shutdown(); err != nil {
+		t.Error(err)
+	}
+	if conn, err := net.DialTimeout("tcp", addr.String(), time.Second); err == nil {
+		conn.Close()
+		t.Error("expected all the listeners closed")
+	}
+}
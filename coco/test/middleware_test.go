@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"github.com/246859/codis/coco"
+	"net"
+	"testing"
+	"time"
+)
+
+type recordHandler struct {
+	records *[]string
+	closed  bool
+}
+
+func (r *recordHandler) Handle(ctx context.Context, client *coco.Client) {
+	*r.records = append(*r.records, "handler")
+}
+
+func (r *recordHandler) Close() error {
+	r.closed = true
+	return nil
+}
+
+func record(records *[]string, name string) coco.Middleware {
+	return func(next coco.HandlerFunc) coco.HandlerFunc {
+		return func(ctx context.Context, client *coco.Client) {
+			*records = append(*records, name+" before")
+			next(ctx, client)
+			*records = append(*records, name+" after")
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	var records []string
+	inner := &recordHandler{records: &records}
+
+	chain := coco.NewChain(record(&records, "a"))
+	extended := chain.Append(record(&records, "b"))
+	if len(chain) != 1 || len(extended) != 2 {
+		t.Fatalf("expected append not modify the original chain, got %d %d", len(chain), len(extended))
+	}
+
+	handler := extended.Then(inner)
+	handler.Handle(context.Background(), nil)
+
+	expected := []string{"a before", "b before", "handler", "b after", "a after"}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, records)
+	}
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, records)
+		}
+	}
+
+	handler.Close()
+	if !inner.closed {
+		t.Error("expected Close delegated to the handler")
+	}
+
+	if coco.NewChain().Then(inner) != coco.Handler(inner) {
+		t.Error("expected empty chain returns the handler itself")
+	}
+}
+
+type panicHandler struct{}
+
+func (p panicHandler) Handle(ctx context.Context, client *coco.Client) {
+	buf := make([]byte, 16)
+	client.Read(buf)
+	panic("boom")
+}
+
+func (p panicHandler) Close() error {
+	return nil
+}
+
+func TestServer_Recovery(t *testing.T) {
+	var records []string
+	server := coco.NewServer(context.Background(),
+		coco.WithCloseTimeout(time.Second),
+		coco.WithMiddleware(record(&records, "m")),
+	)
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listen, panicHandler{})
+	defer server.Shutdown()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listen.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("hello\n"))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		// the panicking connection is closed and the server keeps serving
+		if _, err := conn.Read(make([]byte, 16)); err == nil {
+			t.Error("expected connection closed after panic")
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for server.ConnCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := server.ConnCount(); count != 0 {
+		t.Errorf("expected connections released, got %d", count)
+	}
+	if len(records) != 2 || records[0] != "m before" {
+		t.Errorf("expected the middleware applied and unwound by panic, got %v", records)
+	}
+}
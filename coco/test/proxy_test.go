@@ -0,0 +1,137 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/246859/codis/coco"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addrHandler replies the remote and upstream address of client for every line
+type addrHandler struct{}
+
+func (a addrHandler) Handle(ctx context.Context, client *coco.Client) {
+	reader := bufio.NewReader(client)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(client, "%s %s %s", client.RemoteAddr(), client.UpstreamAddr(), line)
+	}
+}
+
+func (a addrHandler) Close() error {
+	return nil
+}
+
+func serveProxy(t *testing.T, cfg coco.ProxyConfig) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxied, err := coco.NewProxyListener(lis, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := coco.NewServer(context.Background(), coco.WithCloseTimeout(time.Second))
+	go server.Serve(proxied, addrHandler{})
+	t.Cleanup(func() { server.Shutdown() })
+	return lis.Addr().String()
+}
+
+// send writes the data and returns the reply line, or the error if the connection is closed
+func send(t *testing.T, addr string, data []byte) (string, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	conn.Write(data)
+	return bufio.NewReader(conn).ReadString('\n')
+}
+
+func proxyV2(family byte, src, dst net.IP, sport, dport uint16) []byte {
+	header := []byte("\r\n\r\n\x00\r\nQUIT\n")
+	header = append(header, 0x21, family)
+	addrs := append(append([]byte{}, src...), dst...)
+	addrs = binary.BigEndian.AppendUint16(addrs, sport)
+	addrs = binary.BigEndian.AppendUint16(addrs, dport)
+	// a TLV which should be skipped
+	addrs = append(addrs, 0x04, 0x00, 0x01, 0xff)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+func TestProxyProtocol(t *testing.T) {
+	addr := serveProxy(t, coco.ProxyConfig{Enabled: true})
+
+	reply, err := send(t, addr, []byte("PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\nhello\n"))
+	if err != nil || !strings.HasPrefix(reply, "1.2.3.4:1111 127.0.0.1:") || !strings.HasSuffix(reply, " hello\n") {
+		t.Errorf("unexpected v1 reply %q %v", reply, err)
+	}
+
+	reply, err = send(t, addr, []byte("PROXY TCP6 2001:db8::1 2001:db8::2 1111 2222\r\nhello\n"))
+	if err != nil || !strings.HasPrefix(reply, "[2001:db8::1]:1111 127.0.0.1:") {
+		t.Errorf("unexpected v1 reply %q %v", reply, err)
+	}
+
+	reply, err = send(t, addr, append(proxyV2(0x11, net.IPv4(1, 2, 3, 4).To4(), net.IPv4(5, 6, 7, 8).To4(), 1111, 2222), "hello\n"...))
+	if err != nil || !strings.HasPrefix(reply, "1.2.3.4:1111 127.0.0.1:") {
+		t.Errorf("unexpected v2 reply %q %v", reply, err)
+	}
+
+	reply, err = send(t, addr, append(proxyV2(0x21, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 1111, 2222), "hello\n"...))
+	if err != nil || !strings.HasPrefix(reply, "[2001:db8::1]:1111 127.0.0.1:") {
+		t.Errorf("unexpected v2 reply %q %v", reply, err)
+	}
+
+	// direct connection without header
+	reply, err = send(t, addr, []byte("PING\n"))
+	if err != nil || !strings.HasPrefix(reply, "127.0.0.1:") {
+		t.Errorf("unexpected direct reply %q %v", reply, err)
+	}
+
+	// invalid header
+	if _, err := send(t, addr, []byte("PROXY TCP4 1.2.3.4 5.6.7.8 99999 2222\r\nhello\n")); err == nil {
+		t.Error("expected invalid header rejected")
+	}
+}
+
+func TestProxyProtocolRequired(t *testing.T) {
+	addr := serveProxy(t, coco.ProxyConfig{Enabled: true, Required: true, TrustedCIDRs: []string{"127.0.0.1"}})
+
+	if reply, err := send(t, addr, []byte("PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\nhello\n")); err != nil {
+		t.Errorf("unexpected reply %q %v", reply, err)
+	}
+	if _, err := send(t, addr, []byte("PING\n")); err == nil {
+		t.Error("expected connection without header rejected")
+	}
+
+	untrusted := serveProxy(t, coco.ProxyConfig{Enabled: true, Required: true, TrustedCIDRs: []string{"10.0.0.0/8"}})
+	if _, err := send(t, untrusted, []byte("PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\nhello\n")); err == nil {
+		t.Error("expected untrusted upstream rejected")
+	}
+}
+
+func TestProxyProtocolUntrusted(t *testing.T) {
+	addr := serveProxy(t, coco.ProxyConfig{Enabled: true, TrustedCIDRs: []string{"10.0.0.0/8"}})
+
+	// the header from untrusted upstream is not parsed
+	reply, err := send(t, addr, []byte("PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\n"))
+	if err != nil || !strings.HasPrefix(reply, "127.0.0.1:") {
+		t.Errorf("unexpected reply %q %v", reply, err)
+	}
+
+	if _, err := coco.NewProxyListener(nil, coco.ProxyConfig{TrustedCIDRs: []string{"10.0.0.0/33"}}); !errors.Is(err, coco.ErrInvalidCIDR) {
+		t.Errorf("expected invalid CIDR, got %v", err)
+	}
+}
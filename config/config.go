@@ -0,0 +1,267 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/246859/codis/coco"
+	"github.com/246859/codis/pkg/logger"
+	"github.com/246859/codis/redis/resproto2"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Config is the configuration of codis server
+type Config struct {
+	Network     Network       `yaml:"network"`
+	Log         logger.Config `yaml:"log"`
+	Persistence Persistence   `yaml:"persistence"`
+	Memory      Memory        `yaml:"memory"`
+	// number of logical databases
+	Databases int `yaml:"databases"`
+}
+
+type Network struct {
+	Bind string `yaml:"bind"`
+	Port int    `yaml:"port"`
+	// path of unix domain socket, empty means not listening on unix socket
+	UnixSocket string `yaml:"unixSocket"`
+	// permissions of unix socket in octal, like 700
+	UnixSocketPerm string `yaml:"unixSocketPerm"`
+	TLS            TLS    `yaml:"tls"`
+	// PROXY protocol on the tcp and tls listeners
+	Proxy coco.ProxyConfig `yaml:"proxy"`
+	// serve the tcp and unix listeners in event-loop mode on linux, the number of loops is eventLoops,
+	// the tls listener and the listeners with PROXY protocol are always served by a goroutine per connection
+	EventLoop   bool `yaml:"eventLoop"`
+	coco.Config `yaml:",inline"`
+	// limits of client requests
+	Limits resproto2.Limits `yaml:"limits"`
+}
+
+type TLS struct {
+	// 0 means tls is disabled
+	Port           int `yaml:"port"`
+	coco.TLSConfig `yaml:",inline"`
+}
+
+type Persistence struct {
+	Dir        string `yaml:"dir"`
+	DBFilename string `yaml:"dbFilename"`
+	AppendOnly bool   `yaml:"appendOnly"`
+	// always, everysec or no
+	AppendFsync string `yaml:"appendFsync"`
+}
+
+type Memory struct {
+	// 0 means no limit
+	MaxMemory       Size   `yaml:"maxMemory"`
+	MaxMemoryPolicy string `yaml:"maxMemoryPolicy"`
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		Network: Network{
+			Bind: "127.0.0.1",
+			Port: 6379,
+			Config: coco.Config{
+				MaxConn:      128,
+				Timeout:      0,
+				KeepAlive:    300 * time.Second,
+				CloseTimeout: 10 * time.Second,
+				Backoff: coco.Backoff{
+					Initial:    5 * time.Millisecond,
+					Max:        time.Second,
+					Multiplier: 2,
+				},
+			},
+			UnixSocketPerm: "700",
+			TLS: TLS{
+				TLSConfig: coco.TLSConfig{AuthClients: "no"},
+			},
+			Limits: resproto2.DefaultLimits,
+		},
+		Log: logger.Config{
+			Level:  logger.LevelInfo,
+			Format: logger.TextFormat,
+		},
+		Persistence: Persistence{
+			Dir:         ".",
+			DBFilename:  "dump.rdb",
+			AppendOnly:  false,
+			AppendFsync: "everysec",
+		},
+		Memory: Memory{
+			MaxMemory:       0,
+			MaxMemoryPolicy: "noeviction",
+		},
+		Databases: 16,
+	}
+}
+
+type loadOptions struct {
+	lenient bool
+}
+
+type LoadOption func(opts *loadOptions)
+
+// WithLenient ignores the unknown directives in redis.conf instead of failing
+func WithLenient(lenient bool) LoadOption {
+	return func(opts *loadOptions) {
+		opts.lenient = lenient
+	}
+}
+
+// Load builds the configuration in the order of precedence:
+// defaults < config file < environment variables < overrides, and validates the result.
+// The file is optional, it is loaded as redis.conf if its extension is .conf, otherwise as yaml.
+// Overrides are keys like network.port mapped to their values.
+func Load(path string, overrides map[string]string, opts ...LoadOption) (*Config, error) {
+	var options loadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	cfg := Default()
+
+	if filepath.Ext(path) == ".conf" {
+		if err := cfg.LoadRedisConf(path, options.lenient); err != nil {
+			return nil, err
+		}
+	} else if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+
+	for key, value := range overrides {
+		if err := cfg.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFile reads the yaml file into cfg, the keys absent in the file keep their current values,
+// unknown keys are treated as errors.
+func (c *Config) LoadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return nil
+}
+
+var (
+	fsyncPolicies = []string{"always", "everysec", "no"}
+
+	evictionPolicies = []string{
+		"noeviction",
+		"allkeys-lru", "allkeys-lfu", "allkeys-random",
+		"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl",
+	}
+
+	logLevels = []string{
+		logger.LevelTrace, logger.LevelDebug, logger.LevelInfo, logger.LevelWarn,
+		logger.LevelError, logger.LevelPanic, logger.LevelFatal,
+	}
+
+	logFormats = []string{logger.TextFormat, logger.JsonFormat}
+
+	tlsAuthClients = []string{"no", "optional", "yes"}
+)
+
+// Validate checks all values and reports every invalid one
+func (c *Config) Validate() error {
+	var errs []error
+
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("config: "+format, args...))
+		}
+	}
+
+	check(c.Network.Bind != "", "network.bind must not be empty")
+	check(c.Network.Port > 0 && c.Network.Port <= 65535, "network.port must be between 1 and 65535, got %d", c.Network.Port)
+	_, permErr := c.Network.SocketPerm()
+	check(permErr == nil, "network.unixSocketPerm must be octal permissions like 700, got %q", c.Network.UnixSocketPerm)
+	check(c.Network.TLS.Port >= 0 && c.Network.TLS.Port <= 65535, "network.tls.port must be between 0 and 65535, got %d", c.Network.TLS.Port)
+	check(c.Network.TLS.Port == 0 || c.Network.TLS.CertFile != "" && c.Network.TLS.KeyFile != "",
+		"network.tls.certFile and network.tls.keyFile are required when tls is enabled")
+	check(oneOf(c.Network.TLS.AuthClients, tlsAuthClients),
+		"network.tls.authClients must be one of %v, got %q", tlsAuthClients, c.Network.TLS.AuthClients)
+	proxyErr := c.Network.Proxy.Validate()
+	check(proxyErr == nil, "network.proxy is invalid: %v", proxyErr)
+	check(c.Network.MaxConn > 0, "network.maxConn must be positive")
+	check(c.Network.Timeout >= 0, "network.timeout must not be negative, got %s", c.Network.Timeout)
+	check(c.Network.ReadTimeout >= 0, "network.readTimeout must not be negative, got %s", c.Network.ReadTimeout)
+	check(c.Network.WriteTimeout >= 0, "network.writeTimeout must not be negative, got %s", c.Network.WriteTimeout)
+	check(c.Network.CloseTimeout >= 0, "network.closeTimeout must not be negative, got %s", c.Network.CloseTimeout)
+	check(c.Network.ReusePort >= 0, "network.reusePort must not be negative, got %d", c.Network.ReusePort)
+	check(c.Network.EventLoops >= 0, "network.eventLoops must not be negative, got %d", c.Network.EventLoops)
+	check(c.Network.Retry >= 0, "network.retry must not be negative, got %s", c.Network.Retry)
+	check(c.Network.Backoff.Initial > 0, "network.backoff.initial must be positive, got %s", c.Network.Backoff.Initial)
+	check(c.Network.Backoff.Max >= c.Network.Backoff.Initial,
+		"network.backoff.max must not be less than initial, got %s", c.Network.Backoff.Max)
+	check(c.Network.Backoff.Multiplier >= 1, "network.backoff.multiplier must be at least 1, got %g", c.Network.Backoff.Multiplier)
+	check(c.Network.Backoff.MaxRetries >= 0, "network.backoff.maxRetries must not be negative, got %d", c.Network.Backoff.MaxRetries)
+	check(c.Network.Limits.MaxBulkLen >= 0, "network.limits.maxBulkLen must not be negative")
+	check(c.Network.Limits.MaxMultiBulkLen >= 0, "network.limits.maxMultiBulkLen must not be negative")
+	check(c.Network.Limits.MaxDepth >= 0, "network.limits.maxDepth must not be negative")
+	check(c.Network.Limits.MaxInlineLen >= 0, "network.limits.maxInlineLen must not be negative")
+
+	check(oneOf(c.Log.Level, logLevels), "log.level must be one of %v, got %q", logLevels, c.Log.Level)
+	check(oneOf(c.Log.Format, logFormats), "log.format must be one of %v, got %q", logFormats, c.Log.Format)
+
+	check(c.Persistence.Dir != "", "persistence.dir must not be empty")
+	check(c.Persistence.DBFilename != "", "persistence.dbFilename must not be empty")
+	check(oneOf(c.Persistence.AppendFsync, fsyncPolicies),
+		"persistence.appendFsync must be one of %v, got %q", fsyncPolicies, c.Persistence.AppendFsync)
+
+	check(oneOf(c.Memory.MaxMemoryPolicy, evictionPolicies),
+		"memory.maxMemoryPolicy must be one of %v, got %q", evictionPolicies, c.Memory.MaxMemoryPolicy)
+
+	check(c.Databases > 0, "databases must be positive, got %d", c.Databases)
+
+	return errors.Join(errs...)
+}
+
+// SocketPerm returns the permissions of unix socket
+func (n Network) SocketPerm() (os.FileMode, error) {
+	if n.UnixSocketPerm == "" {
+		return 0, nil
+	}
+	perm, err := strconv.ParseUint(n.UnixSocketPerm, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, fmt.Errorf("invalid permissions %q", n.UnixSocketPerm)
+	}
+	return os.FileMode(perm), nil
+}
+
+func oneOf(s string, set []string) bool {
+	for _, e := range set {
+		if s == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of environment variables, e.g. CODIS_NETWORK_PORT overrides network.port
+const EnvPrefix = "CODIS_"
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	sizeType     = reflect.TypeOf(Size(0))
+)
+
+// Keys returns all the keys can be overridden, like network.port and log.level
+func (c *Config) Keys() []string {
+	var keys []string
+	walkKeys(reflect.TypeOf(c).Elem(), "", &keys)
+	return keys
+}
+
+func walkKeys(typ reflect.Type, prefix string, keys *[]string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, inline := yamlName(field)
+		if name == "-" {
+			continue
+		}
+
+		if inline {
+			walkKeys(field.Type, prefix, keys)
+		} else if field.Type.Kind() == reflect.Struct {
+			walkKeys(field.Type, prefix+name+".", keys)
+		} else {
+			*keys = append(*keys, prefix+name)
+		}
+	}
+}
+
+// Set overrides a single key with a string value, the key is case-insensitive
+func (c *Config) Set(key, value string) error {
+	field, ok := lookupField(reflect.ValueOf(c).Elem(), strings.Split(key, "."))
+	if !ok {
+		return fmt.Errorf("config: unknown key %q", key)
+	}
+
+	if err := setValue(field, value); err != nil {
+		return fmt.Errorf("config: invalid value %q for %s: %w", value, key, err)
+	}
+	return nil
+}
+
+// ApplyEnv overrides the keys with environment variables, environ is in form of key=value like os.Environ().
+// The variable name is EnvPrefix followed by the upper-case key with dots replaced by underscores.
+func (c *Config) ApplyEnv(environ []string) error {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	for _, key := range c.Keys() {
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if value, ok := env[name]; ok {
+			if err := c.Set(key, value); err != nil {
+				return fmt.Errorf("%w (from %s)", err, name)
+			}
+		}
+	}
+	return nil
+}
+
+func lookupField(v reflect.Value, path []string) (reflect.Value, bool) {
+	if len(path) == 0 {
+		return v, true
+	}
+
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		name, inline := yamlName(typ.Field(i))
+		if inline {
+			if field, ok := lookupField(v.Field(i), path); ok {
+				return field, true
+			}
+		} else if strings.EqualFold(name, path[0]) {
+			if len(path) > 1 && v.Field(i).Kind() != reflect.Struct {
+				return reflect.Value{}, false
+			}
+			return lookupField(v.Field(i), path[1:])
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	case field.Type() == sizeType:
+		size, err := ParseSize(value)
+		if err != nil {
+			return err
+		}
+		field.SetUint(uint64(size))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Slice:
+		// comma separated strings
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values).Convert(field.Type()))
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// yamlName returns the key name in yaml tag, and whether the field is inlined
+func yamlName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("yaml")
+	name, opts, _ := strings.Cut(tag, ",")
+	if strings.Contains(opts, "inline") {
+		return "", true
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, false
+}
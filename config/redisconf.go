@@ -0,0 +1,296 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/246859/codis/pkg/logger"
+	"github.com/246859/codis/redis/resproto2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// max depth of nested include directives, avoid including files recursively forever
+const maxIncludeDepth = 16
+
+// directive describes how to apply a redis.conf directive onto Config
+type directive struct {
+	// number of arguments, negative means at least -args arguments
+	args  int
+	apply func(c *Config, args []string) error
+}
+
+var directives = map[string]directive{
+	"bind": {args: -1, apply: func(c *Config, args []string) error {
+		if len(args) > 1 {
+			logger.Warnf("config: codis can only bind one address, %s is used", args[0])
+		}
+		c.Network.Bind = strings.TrimPrefix(args[0], "-")
+		return nil
+	}},
+	"port": {args: 1, apply: func(c *Config, args []string) error {
+		return setInt(&c.Network.Port, args[0])
+	}},
+	"maxclients": {args: 1, apply: func(c *Config, args []string) error {
+		n, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		c.Network.MaxConn = n
+		return nil
+	}},
+	"timeout": {args: 1, apply: func(c *Config, args []string) error {
+		return setSeconds(&c.Network.Timeout, args[0])
+	}},
+	"tcp-keepalive": {args: 1, apply: func(c *Config, args []string) error {
+		if err := setSeconds(&c.Network.KeepAlive, args[0]); err != nil {
+			return err
+		}
+		// 0 disables keepalive in redis
+		if c.Network.KeepAlive == 0 {
+			c.Network.KeepAlive = -1
+		}
+		return nil
+	}},
+	"unixsocket": {args: 1, apply: func(c *Config, args []string) error {
+		c.Network.UnixSocket = args[0]
+		return nil
+	}},
+	"unixsocketperm": {args: 1, apply: func(c *Config, args []string) error {
+		c.Network.UnixSocketPerm = args[0]
+		return nil
+	}},
+	"tls-port": {args: 1, apply: func(c *Config, args []string) error {
+		return setInt(&c.Network.TLS.Port, args[0])
+	}},
+	"tls-cert-file": {args: 1, apply: func(c *Config, args []string) error {
+		c.Network.TLS.CertFile = args[0]
+		return nil
+	}},
+	"tls-key-file": {args: 1, apply: func(c *Config, args []string) error {
+		c.Network.TLS.KeyFile = args[0]
+		return nil
+	}},
+	"tls-ca-cert-file": {args: 1, apply: func(c *Config, args []string) error {
+		c.Network.TLS.CAFile = args[0]
+		return nil
+	}},
+	"tls-auth-clients": {args: 1, apply: func(c *Config, args []string) error {
+		c.Network.TLS.AuthClients = strings.ToLower(args[0])
+		return nil
+	}},
+	"proto-max-bulk-len": {args: 1, apply: func(c *Config, args []string) error {
+		size, err := ParseSize(args[0])
+		if err != nil {
+			return err
+		}
+		c.Network.Limits.MaxBulkLen = int64(size)
+		return nil
+	}},
+	"loglevel": {args: 1, apply: func(c *Config, args []string) error {
+		level, ok := redisLogLevels[strings.ToLower(args[0])]
+		if !ok {
+			return fmt.Errorf("invalid log level %q", args[0])
+		}
+		c.Log.Level = level
+		return nil
+	}},
+	"logfile": {args: 1, apply: func(c *Config, args []string) error {
+		// empty means standard output
+		c.Log.InfoLog = args[0]
+		c.Log.ErrorLog = args[0]
+		return nil
+	}},
+	"dir": {args: 1, apply: func(c *Config, args []string) error {
+		c.Persistence.Dir = args[0]
+		return nil
+	}},
+	"dbfilename": {args: 1, apply: func(c *Config, args []string) error {
+		c.Persistence.DBFilename = args[0]
+		return nil
+	}},
+	"appendonly": {args: 1, apply: func(c *Config, args []string) error {
+		return setYesNo(&c.Persistence.AppendOnly, args[0])
+	}},
+	"appendfsync": {args: 1, apply: func(c *Config, args []string) error {
+		c.Persistence.AppendFsync = strings.ToLower(args[0])
+		return nil
+	}},
+	"maxmemory": {args: 1, apply: func(c *Config, args []string) error {
+		size, err := ParseSize(args[0])
+		if err != nil {
+			return err
+		}
+		c.Memory.MaxMemory = size
+		return nil
+	}},
+	"maxmemory-policy": {args: 1, apply: func(c *Config, args []string) error {
+		c.Memory.MaxMemoryPolicy = strings.ToLower(args[0])
+		return nil
+	}},
+	"databases": {args: 1, apply: func(c *Config, args []string) error {
+		return setInt(&c.Databases, args[0])
+	}},
+}
+
+// the directives which are valid in redis.conf but not supported by codis
+var unsupportedDirectives = map[string]struct{}{}
+
+func init() {
+	for _, name := range []string{
+		"protected-mode", "tcp-backlog", "socket-mark-id",
+		"daemonize", "supervised", "pidfile", "syslog-enabled", "syslog-ident", "syslog-facility",
+		"crash-log-enabled", "crash-memcheck-enabled", "always-show-logo", "set-proc-title", "proc-title-template",
+		"locale-collate", "save", "stop-writes-on-bgsave-error", "rdbcompression", "rdbchecksum",
+		"sanitize-dump-payload", "rdb-del-sync-files", "replicaof", "slaveof", "masterauth", "masteruser",
+		"replica-serve-stale-data", "replica-read-only", "repl-diskless-sync", "repl-diskless-sync-delay",
+		"repl-diskless-sync-max-replicas", "repl-diskless-load", "repl-ping-replica-period", "repl-timeout",
+		"repl-disable-tcp-nodelay", "repl-backlog-size", "repl-backlog-ttl", "replica-priority",
+		"min-replicas-to-write", "min-replicas-max-lag", "requirepass", "acllog-max-len", "aclfile",
+		"rename-command", "maxmemory-samples", "maxmemory-eviction-tenacity", "replica-ignore-maxmemory",
+		"active-expire-effort", "lazyfree-lazy-eviction", "lazyfree-lazy-expire", "lazyfree-lazy-server-del",
+		"replica-lazy-flush", "lazyfree-lazy-user-del", "lazyfree-lazy-user-flush", "io-threads",
+		"io-threads-do-reads", "oom-score-adj", "oom-score-adj-values", "disable-thp", "appendfilename",
+		"appenddirname", "no-appendfsync-on-rewrite", "auto-aof-rewrite-percentage", "auto-aof-rewrite-min-size",
+		"aof-load-truncated", "aof-use-rdb-preamble", "aof-timestamp-enabled", "shutdown-timeout",
+		"shutdown-on-sigint", "shutdown-on-sigterm", "lua-time-limit", "busy-reply-threshold",
+		"cluster-enabled", "cluster-config-file", "cluster-node-timeout", "cluster-port",
+		"slowlog-log-slower-than", "slowlog-max-len", "latency-monitor-threshold", "latency-tracking",
+		"latency-tracking-info-percentiles", "notify-keyspace-events", "hash-max-listpack-entries",
+		"hash-max-listpack-value", "hash-max-ziplist-entries", "hash-max-ziplist-value", "list-max-listpack-size",
+		"list-max-ziplist-size", "list-compress-depth", "set-max-intset-entries", "set-max-listpack-entries",
+		"set-max-listpack-value", "zset-max-listpack-entries", "zset-max-listpack-value",
+		"zset-max-ziplist-entries", "zset-max-ziplist-value", "hll-sparse-max-bytes", "stream-node-max-bytes",
+		"stream-node-max-entries", "activerehashing", "client-output-buffer-limit", "client-query-buffer-limit",
+		"hz", "dynamic-hz", "aof-rewrite-incremental-fsync", "rdb-save-incremental-fsync", "lfu-log-factor",
+		"lfu-decay-time", "activedefrag", "active-defrag-ignore-bytes", "active-defrag-threshold-lower",
+		"active-defrag-threshold-upper", "active-defrag-cycle-min", "active-defrag-cycle-max",
+		"active-defrag-max-scan-fields", "jemalloc-bg-thread", "server_cpulist", "bio_cpulist",
+		"aof_rewrite_cpulist", "bgsave_cpulist", "ignore-warnings", "enable-protected-configs",
+		"enable-debug-command", "enable-module-command", "loadmodule",
+		"tls-key-file-pass", "tls-ca-cert-dir", "tls-replication", "tls-cluster", "tls-protocols", "tls-ciphers", "tls-ciphersuites",
+		"tls-prefer-server-ciphers", "tls-session-caching", "tls-session-cache-size", "tls-session-cache-timeout",
+	} {
+		unsupportedDirectives[name] = struct{}{}
+	}
+}
+
+// redis log levels mapped to codis log levels
+var redisLogLevels = map[string]string{
+	"debug":   logger.LevelDebug,
+	"verbose": logger.LevelDebug,
+	"notice":  logger.LevelInfo,
+	"warning": logger.LevelWarn,
+	"nothing": logger.LevelFatal,
+}
+
+// LoadRedisConf reads a redis.conf style file into cfg. The supported directives are mapped onto Config,
+// the recognized but unsupported ones are logged as warnings, and the unknown ones are treated as errors
+// unless lenient is true.
+func (c *Config) LoadRedisConf(path string, lenient bool) error {
+	return c.loadRedisConf(path, lenient, 0)
+}
+
+func (c *Config) loadRedisConf(path string, lenient bool, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("config: too many nested includes in %s", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		rawArgs, err := resproto2.SplitArgs([]byte(line))
+		if err != nil {
+			return fmt.Errorf("config: %s:%d: %w", path, lineNum, err)
+		}
+
+		args := make([]string, 0, len(rawArgs))
+		for _, arg := range rawArgs {
+			args = append(args, string(arg))
+		}
+
+		if err := c.applyDirective(strings.ToLower(args[0]), args[1:], lenient, depth); err != nil {
+			return fmt.Errorf("config: %s:%d: %w", path, lineNum, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+func (c *Config) applyDirective(name string, args []string, lenient bool, depth int) error {
+	if name == "include" {
+		if len(args) != 1 {
+			return errors.New("wrong number of arguments for 'include'")
+		}
+		return c.loadRedisConf(args[0], lenient, depth+1)
+	}
+
+	d, ok := directives[name]
+	if !ok {
+		if _, ok := unsupportedDirectives[name]; ok {
+			logger.Warnf("config: directive '%s' is not supported by codis, ignored", name)
+			return nil
+		} else if lenient {
+			logger.Warnf("config: unknown directive '%s', ignored", name)
+			return nil
+		}
+		return fmt.Errorf("unknown directive '%s'", name)
+	}
+
+	if d.args >= 0 && len(args) != d.args || d.args < 0 && len(args) < -d.args {
+		return fmt.Errorf("wrong number of arguments for '%s'", name)
+	}
+
+	if err := d.apply(c, args); err != nil {
+		return fmt.Errorf("invalid argument for '%s': %w", name, err)
+	}
+	return nil
+}
+
+func setInt(dst *int, s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*dst = i
+	return nil
+}
+
+func setSeconds(dst *time.Duration, s string) error {
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*dst = time.Duration(seconds) * time.Second
+	return nil
+}
+
+func setYesNo(dst *bool, s string) error {
+	switch strings.ToLower(s) {
+	case "yes":
+		*dst = true
+	case "no":
+		*dst = false
+	default:
+		return fmt.Errorf("argument must be 'yes' or 'no', got %q", s)
+	}
+	return nil
+}
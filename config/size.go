@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strconv"
+	"strings"
+)
+
+// Size is a memory size in bytes, it can be written with units like redis.conf,
+// 1k => 1000 bytes, 1kb => 1024 bytes, 1m => 1000000 bytes, 1mb => 1024*1024 bytes, and so on.
+type Size uint64
+
+var sizeUnits = map[string]uint64{
+	"":   1,
+	"b":  1,
+	"k":  1000,
+	"kb": 1024,
+	"m":  1000 * 1000,
+	"mb": 1024 * 1024,
+	"g":  1000 * 1000 * 1000,
+	"gb": 1024 * 1024 * 1024,
+}
+
+// ParseSize parse a memory size with units, the unit is case-insensitive
+func ParseSize(s string) (Size, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+
+	i := 0
+	for i < len(str) && str[i] >= '0' && str[i] <= '9' {
+		i++
+	}
+
+	if i == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	unit, ok := sizeUnits[str[i:]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit %q", s)
+	}
+
+	n, err := strconv.ParseUint(str[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	if n > 0 && unit > ^uint64(0)/n {
+		return 0, fmt.Errorf("size %q overflows", s)
+	}
+
+	return Size(n * unit), nil
+}
+
+func (s Size) String() string {
+	return strconv.FormatUint(uint64(s), 10)
+}
+
+func (s *Size) UnmarshalYAML(value *yaml.Node) error {
+	size, err := ParseSize(value.Value)
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
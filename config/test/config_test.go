@@ -0,0 +1,135 @@
+package test
+
+import (
+	"github.com/246859/codis/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	cfg, err := config.Load("testdata/codis.yaml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Network.Bind != "0.0.0.0" || cfg.Network.Port != 7379 || cfg.Network.MaxConn != 1000 {
+		t.Errorf("unexpected network config %+v", cfg.Network)
+	}
+	if cfg.Network.Timeout != 30*time.Second || cfg.Network.CloseTimeout != 5*time.Second {
+		t.Errorf("unexpected timeouts %+v", cfg.Network.Config)
+	}
+	if !cfg.Network.EventLoop || cfg.Network.EventLoops != 4 {
+		t.Errorf("unexpected event loops %+v", cfg.Network)
+	}
+	// the deprecated retry key is still accepted
+	if cfg.Network.Retry != 2*time.Second {
+		t.Errorf("unexpected retry %s", cfg.Network.Retry)
+	}
+	// absent keys keep the defaults
+	if cfg.Network.Backoff.Max != time.Second || cfg.Network.Limits.MaxMultiBulkLen != 1024*1024 {
+		t.Errorf("expected default values, got %+v", cfg.Network)
+	}
+	if cfg.Network.Limits.MaxBulkLen != 1048576 {
+		t.Errorf("unexpected limits %+v", cfg.Network.Limits)
+	}
+	if cfg.Log.Level != "debug" || cfg.Log.Format != "json" {
+		t.Errorf("unexpected log config %+v", cfg.Log)
+	}
+	if !cfg.Persistence.AppendOnly || cfg.Persistence.AppendFsync != "everysec" {
+		t.Errorf("unexpected persistence config %+v", cfg.Persistence)
+	}
+	if cfg.Memory.MaxMemory != 1024*1024*1024 || cfg.Memory.MaxMemoryPolicy != "allkeys-lru" {
+		t.Errorf("unexpected memory config %+v", cfg.Memory)
+	}
+	if cfg.Databases != 32 {
+		t.Errorf("unexpected databases %d", cfg.Databases)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := config.Load("testdata/invalid.yaml", nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	for _, key := range []string{"network.port", "network.eventLoops", "network.backoff.multiplier", "log.level"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected error about %s, got %v", key, err)
+		}
+	}
+
+	if _, err := config.Load("testdata/unknown.yaml", nil); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+
+	if _, err := config.Load("testdata/missing.yaml", nil); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestOverride(t *testing.T) {
+	t.Setenv("CODIS_NETWORK_PORT", "8000")
+	t.Setenv("CODIS_MEMORY_MAXMEMORY", "100mb")
+	t.Setenv("CODIS_LOG_LEVEL", "warn")
+
+	cfg, err := config.Load("testdata/codis.yaml", map[string]string{
+		"log.level":       "error",
+		"network.timeout": "1m",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// env overrides file
+	if cfg.Network.Port != 8000 || cfg.Memory.MaxMemory != 100*1024*1024 {
+		t.Errorf("env override failed: %+v %+v", cfg.Network, cfg.Memory)
+	}
+	// overrides take precedence over env
+	if cfg.Log.Level != "error" || cfg.Network.Timeout != time.Minute {
+		t.Errorf("override failed: %+v %+v", cfg.Log, cfg.Network.Config)
+	}
+
+	if err := cfg.Set("network.unknown", "1"); err == nil {
+		t.Error("expected unknown key error")
+	}
+	if err := cfg.Set("network.port", "abc"); err == nil {
+		t.Error("expected invalid value error")
+	}
+
+	// comma separated list
+	if err := cfg.Set("network.proxy.trustedCIDRs", "10.0.0.0/8, 192.168.1.10"); err != nil {
+		t.Fatal(err)
+	}
+	if cidrs := cfg.Network.Proxy.TrustedCIDRs; len(cidrs) != 2 || cidrs[0] != "10.0.0.0/8" || cidrs[1] != "192.168.1.10" {
+		t.Errorf("unexpected trusted CIDRs %v", cidrs)
+	}
+	cfg.Network.Proxy.TrustedCIDRs = []string{"10.0.0.0/33"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected invalid CIDR error")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]config.Size{
+		"100":   100,
+		"1k":    1000,
+		"1kb":   1024,
+		"2MB":   2 * 1024 * 1024,
+		"1g":    1000 * 1000 * 1000,
+		"1gb":   1024 * 1024 * 1024,
+		" 10b ": 10,
+	}
+	for s, expected := range cases {
+		size, err := config.ParseSize(s)
+		if err != nil || size != expected {
+			t.Errorf("%q: expected %d, got %d, %v", s, expected, size, err)
+		}
+	}
+
+	for _, s := range []string{"", "gb", "1tb", "-1", "99999999999999999999gb"} {
+		if _, err := config.ParseSize(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"github.com/246859/codis/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRedisConf(t *testing.T) {
+	cfg, err := config.Load("testdata/redis.conf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Network.Bind != "0.0.0.0" || cfg.Network.Port != 7380 || cfg.Network.MaxConn != 500 {
+		t.Errorf("unexpected network config %+v", cfg.Network)
+	}
+	if cfg.Network.Timeout != 300*time.Second || cfg.Network.KeepAlive != 60*time.Second {
+		t.Errorf("unexpected timeout %s, keepalive %s", cfg.Network.Timeout, cfg.Network.KeepAlive)
+	}
+	if perm, _ := cfg.Network.SocketPerm(); cfg.Network.UnixSocket != "/tmp/codis.sock" || perm != 0770 {
+		t.Errorf("unexpected unix socket %s %o", cfg.Network.UnixSocket, perm)
+	}
+	if cfg.Log.Level != "info" || cfg.Log.InfoLog != "" {
+		t.Errorf("unexpected log config %+v", cfg.Log)
+	}
+	if cfg.Persistence.Dir != "/var/lib/redis" || cfg.Persistence.DBFilename != "my dump.rdb" ||
+		!cfg.Persistence.AppendOnly || cfg.Persistence.AppendFsync != "always" {
+		t.Errorf("unexpected persistence config %+v", cfg.Persistence)
+	}
+
+	// from included file
+	if cfg.Memory.MaxMemory != 100*1024*1024 || cfg.Memory.MaxMemoryPolicy != "allkeys-lfu" {
+		t.Errorf("unexpected memory config %+v", cfg.Memory)
+	}
+	if cfg.Network.Limits.MaxBulkLen != 1024*1024*1024 || cfg.Databases != 4 {
+		t.Errorf("unexpected included config %+v %d", cfg.Network.Limits, cfg.Databases)
+	}
+}
+
+func TestLoadRedisConfUnknown(t *testing.T) {
+	_, err := config.Load("testdata/unknown.conf", nil)
+	if err == nil || !strings.Contains(err.Error(), "no-such-directive") || !strings.Contains(err.Error(), ":2") {
+		t.Errorf("expected unknown directive error with line number, got %v", err)
+	}
+
+	cfg, err := config.Load("testdata/unknown.conf", nil, config.WithLenient(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Network.Port != 7380 || cfg.Databases != 8 {
+		t.Errorf("expected directives after unknown one applied, got %+v", cfg)
+	}
+
+	if _, err := config.Load("testdata/badargs.conf", nil); err == nil || !strings.Contains(err.Error(), "wrong number of arguments") {
+		t.Errorf("expected wrong number of arguments, got %v", err)
+	}
+
+	if _, err := config.Load("testdata/loop.conf", nil); err == nil || !strings.Contains(err.Error(), "nested includes") {
+		t.Errorf("expected nested includes error, got %v", err)
+	}
+}
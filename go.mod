@@ -2,11 +2,11 @@ module github.com/246859/codis
 
 go 1.21.0
 
-require github.com/dstgo/filebox v1.0.1
-
 require (
-	github.com/antonfisher/nested-logrus-formatter v1.3.1 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
-	github.com/sirupsen/logrus v1.9.3 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	github.com/antonfisher/nested-logrus-formatter v1.3.1
+	github.com/dstgo/filebox v1.0.1
+	github.com/pkg/errors v0.9.1
+	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -54,6 +54,12 @@ func newLogger(config Config) (*Logger, error) {
 		logrusLogger = logrus.New()
 	)
 
+	level, err := logrus.ParseLevel(config.Level)
+	if err != nil {
+		return logger, err
+	}
+	logrusLogger.SetLevel(level)
+
 	if len(config.InfoLog) > 0 {
 		// setup hooks
 		infoHook, err := newLevelFileHook(config.InfoLog, logrus.InfoLevel, logrus.WarnLevel)
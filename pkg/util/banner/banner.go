@@ -11,14 +11,14 @@ func PrintLnBanner(banner string) {
 
 func PrintlnBannerFs(filename string) {
 	bannerStr, err := filebox.ReadFileString(filename)
-	if err != nil {
+	if err == nil {
 		PrintLnBanner(bannerStr)
 	}
 }
 
 func PrintlnBannerEmbed(fs embed.FS, filename string) {
 	bytes, err := fs.ReadFile(filename)
-	if err != nil {
+	if err == nil {
 		PrintLnBanner(string(bytes))
 	}
 }
@@ -0,0 +1,132 @@
+package glob
+
+// maxNesting limits the recursion of '*', the patterns like "a*a*a*...b" degrade to exponential time otherwise
+const maxNesting = 1000
+
+// Match reports whether s matches the glob-style pattern as redis KEYS does, the special characters are
+// '*' matches any sequence, '?' matches any single byte, '[abc]', '[^abc]' and '[a-z]' match the byte sets,
+// '\' escapes the following character. Unlike path.Match, '/' is not special and malformed patterns never fail.
+func Match(pattern, s string) bool {
+	skipLongerMatches := false
+	return match(pattern, s, false, &skipLongerMatches, 0)
+}
+
+// MatchFold is the case-insensitive version of Match
+func MatchFold(pattern, s string) bool {
+	skipLongerMatches := false
+	return match(pattern, s, true, &skipLongerMatches, 0)
+}
+
+// match is a port of stringmatchlen in redis, skipLongerMatches stops trying the longer matches of
+// the outer '*' once the rest of string is exhausted, since they can not match either.
+func match(pattern, s string, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > maxNesting {
+		return false
+	}
+
+	for len(pattern) > 0 && len(s) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(s) > 0 {
+				if match(pattern[1:], s, nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				s = s[1:]
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			s = s[1:]
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+
+			matched := false
+			for {
+				if len(pattern) == 0 {
+					break
+				} else if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					if pattern[0] == s[0] {
+						matched = true
+					}
+				} else if pattern[0] == ']' {
+					break
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end, c := pattern[0], pattern[2], s[0]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = lower(start), lower(end), lower(c)
+					}
+					pattern = pattern[2:]
+					if c >= start && c <= end {
+						matched = true
+					}
+				} else if equal(pattern[0], s[0], nocase) {
+					matched = true
+				}
+				pattern = pattern[1:]
+			}
+			// the unterminated set is treated as terminated at the end of pattern
+			if len(pattern) == 0 {
+				pattern = "]"
+			}
+
+			if not {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if !equal(pattern[0], s[0], nocase) {
+				return false
+			}
+			s = s[1:]
+		}
+
+		pattern = pattern[1:]
+	}
+
+	// the trailing stars match the empty rest
+	if len(s) == 0 {
+		for len(pattern) > 0 && pattern[0] == '*' {
+			pattern = pattern[1:]
+		}
+	}
+	return len(pattern) == 0 && len(s) == 0
+}
+
+func equal(a, b byte, nocase bool) bool {
+	if nocase {
+		return lower(a) == lower(b)
+	}
+	return a == b
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"github.com/246859/codis/pkg/util/glob"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		matched    bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"", "", true},
+		{"", "a", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "hllo", true},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`[\]]`, "]", true},
+		{"user:*:name", "user:1000:name", true},
+		{"a/*", "a/b/c", true},
+		{"key*", "key", true},
+		{"key**", "key", true},
+		{"*a", "b", false},
+		{"[abc", "a", true},
+		{"[abc", "ab", false},
+		{"ab\\", "ab\\", true},
+	}
+
+	for _, test := range tests {
+		if matched := glob.Match(test.pattern, test.s); matched != test.matched {
+			t.Errorf("Match(%q, %q) expected %v, got %v", test.pattern, test.s, test.matched, matched)
+		}
+	}
+
+	if !glob.MatchFold("H[A-C]LLO*", "hbllo world") || glob.Match("H[A-C]LLO*", "hbllo world") {
+		t.Error("expected MatchFold ignores case")
+	}
+
+	// must not be exponential
+	if glob.Match(strings.Repeat("a*", 30)+"b", strings.Repeat("a", 60)) {
+		t.Error("expected not matched")
+	}
+}
@@ -1,12 +1,11 @@
 package syncx
 
-// Wait when the f() is completed successfully, the channel will be written with struct{}
+// Wait when the f() is completed, the channel will be closed
 func Wait(f func()) chan struct{} {
 	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		f()
-		done <- struct{}{}
-		close(done)
 	}()
 	return done
 }
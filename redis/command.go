@@ -0,0 +1,278 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/redis/resproto3"
+	"net"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrCommandExists  = errors.New("redis: command already registered")
+	ErrInvalidCommand = errors.New("redis: invalid command")
+)
+
+// CommandFlag describes the behavior of a command, the names are the same as the flags in COMMAND reply
+type CommandFlag uint32
+
+const (
+	// FlagWrite the command may modify the keyspace
+	FlagWrite CommandFlag = 1 << iota
+	// FlagReadonly the command only reads the keyspace
+	FlagReadonly
+	// FlagDenyOOM the command may increase memory usage
+	FlagDenyOOM
+	// FlagAdmin the command is an administrative command, e.g. FLUSHALL
+	FlagAdmin
+	// FlagFast the command runs in O(1) or O(log(N)) time
+	FlagFast
+	// FlagBlocking the command may block the client
+	FlagBlocking
+)
+
+var flagNames = []struct {
+	flag CommandFlag
+	name string
+}{
+	{FlagWrite, "write"},
+	{FlagReadonly, "readonly"},
+	{FlagDenyOOM, "denyoom"},
+	{FlagAdmin, "admin"},
+	{FlagFast, "fast"},
+	{FlagBlocking, "blocking"},
+}
+
+// Names returns the names of the flags in fixed order
+func (f CommandFlag) Names() []string {
+	names := make([]string, 0, len(flagNames))
+	for _, fn := range flagNames {
+		if f&fn.flag != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return names
+}
+
+// Client is the connection executing the commands, it is a *coco.Client in goroutine-per-connection mode,
+// or a *coco.EventConn in event-loop mode.
+type Client interface {
+	ID() uint64
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	Name() string
+	SetName(name string)
+	SetLastCommand(cmd string)
+}
+
+// Request is a command being executed, it is reused by the following commands of the client,
+// so do not hold it after the command returns.
+type Request struct {
+	Client   Client
+	Session  *Session
+	Keyspace *database.Keyspace
+	Command  *Command
+	// Args are the arguments including the command name, they are only valid during the call
+	Args [][]byte
+
+	registry *Registry
+}
+
+// CommandFunc executes the command and writes the reply without flushing, the errors of command,
+// e.g. WRONGTYPE, should be replied by writer.WriteError. Returning an error closes the connection.
+type CommandFunc func(req *Request, writer *resproto3.RespWriter) error
+
+// CommandMiddleware wraps the execution of every command, req.Command is resolved and the arity is
+// checked before calling it, it can reply an error and return without calling next to reject the command.
+type CommandMiddleware func(next CommandFunc) CommandFunc
+
+// Command is an entry of the command table, the arity and key positions follow the conventions of redis
+type Command struct {
+	// Name is the lowercase command name
+	Name string
+	// Arity is the number of arguments including the command name, -N means at least N
+	Arity int
+	Flags CommandFlag
+	// FirstKey is the position of the first key, 0 means no keys
+	FirstKey int
+	// LastKey is the position of the last key, -1 means the last argument
+	LastKey int
+	// Step is the distance between the keys, e.g. 2 for MSET key value [key value ...]
+	Step int
+	Func CommandFunc
+}
+
+// CheckArity reports whether n arguments including the command name satisfy the arity
+func (c *Command) CheckArity(n int) bool {
+	if c.Arity >= 0 {
+		return n == c.Arity
+	}
+	return n >= -c.Arity
+}
+
+// Keys returns the key arguments in args according to the key positions
+func (c *Command) Keys(args [][]byte) [][]byte {
+	if c.FirstKey <= 0 || c.FirstKey >= len(args) {
+		return nil
+	}
+
+	last := c.LastKey
+	if last < 0 {
+		last += len(args)
+	}
+	last = min(last, len(args)-1)
+	step := max(c.Step, 1)
+
+	keys := make([][]byte, 0, (last-c.FirstKey)/step+1)
+	for i := c.FirstKey; i <= last; i += step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// HasFlag reports whether the command has all the flags
+func (c *Command) HasFlag(flag CommandFlag) bool {
+	return c.Flags&flag == flag
+}
+
+// maxCommandLen is the length of lookup buffer, the longer names are not registered
+const maxCommandLen = 32
+
+// Registry is the command table of a handler, the commands and middlewares should be registered
+// before serving, it is not safe to modify it concurrently with the lookups.
+type Registry struct {
+	commands    map[string]*Command
+	middlewares []CommandMiddleware
+	// the middlewares wrapped dispatch function
+	dispatch CommandFunc
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		commands: make(map[string]*Command),
+		dispatch: callCommand,
+	}
+}
+
+// DefaultRegistry returns a registry with all the builtin commands
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, cmds := range [][]*Command{connectionCommands(), keyCommands(), stringCommands(), listCommands()} {
+		for _, cmd := range cmds {
+			if err := r.Register(cmd); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return r
+}
+
+// Register adds the command into registry, the name is case-insensitive
+func (r *Registry) Register(cmd *Command) error {
+	if cmd == nil || cmd.Func == nil || cmd.Name == "" || len(cmd.Name) > maxCommandLen || cmd.Arity == 0 {
+		return fmt.Errorf("%w: %+v", ErrInvalidCommand, cmd)
+	}
+
+	name := strings.ToLower(cmd.Name)
+	if _, ok := r.commands[name]; ok {
+		return fmt.Errorf("%w: %s", ErrCommandExists, name)
+	}
+	cmd.Name = name
+	r.commands[name] = cmd
+	return nil
+}
+
+// Lookup finds the command by name case-insensitively
+func (r *Registry) Lookup(name []byte) (*Command, bool) {
+	if len(name) > maxCommandLen {
+		return nil, false
+	}
+
+	var buf [maxCommandLen]byte
+	for i, c := range name {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		buf[i] = c
+	}
+	// the conversion in map index does not allocate
+	cmd, ok := r.commands[string(buf[:len(name)])]
+	return cmd, ok
+}
+
+// Commands returns all the commands sorted by name
+func (r *Registry) Commands() []*Command {
+	cmds := make([]*Command, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+	return cmds
+}
+
+// Len returns the number of commands
+func (r *Registry) Len() int {
+	return len(r.commands)
+}
+
+// Use appends the middlewares, the first one is the outermost
+func (r *Registry) Use(mws ...CommandMiddleware) {
+	r.middlewares = append(r.middlewares, mws...)
+
+	fn := CommandFunc(callCommand)
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		fn = r.middlewares[i](fn)
+	}
+	r.dispatch = fn
+}
+
+func callCommand(req *Request, writer *resproto3.RespWriter) error {
+	return req.Command.Func(req, writer)
+}
+
+// exec looks up the command, checks the arity and executes it through the middlewares
+func (r *Registry) exec(req *Request, writer *resproto3.RespWriter) error {
+	cmd, ok := r.Lookup(req.Args[0])
+	if !ok {
+		return writer.WriteError(unknownCommandError(req.Args))
+	}
+	req.Client.SetLastCommand(cmd.Name)
+
+	if !cmd.CheckArity(len(req.Args)) {
+		return writer.WriteError(wrongArityError(cmd.Name))
+	}
+
+	req.Command = cmd
+	req.registry = r
+	return r.dispatch(req, writer)
+}
+
+func wrongArityError(name string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", name)
+}
+
+// unknownCommandError formats the error as redis does, the args are truncated to 128 bytes
+func unknownCommandError(args [][]byte) error {
+	var b strings.Builder
+	for _, arg := range args[1:] {
+		if b.Len() >= 128 {
+			break
+		}
+		fmt.Fprintf(&b, "'%.*s' ", 128-b.Len(), arg)
+	}
+	return errors.New(protocolSafe(fmt.Sprintf("ERR unknown command '%.128s', with args beginning with: %s", args[0], b.String())))
+}
+
+func unknownSubcommandError(cmd string, sub []byte) error {
+	return errors.New(protocolSafe(fmt.Sprintf("ERR unknown subcommand '%.128s'. Try %s HELP.", sub, strings.ToUpper(cmd))))
+}
+
+// protocolSafe replaces CR and LF with spaces which are not allowed in error replies
+func protocolSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
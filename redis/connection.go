@@ -0,0 +1,236 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"github.com/246859/codis/redis/resproto3"
+	"strings"
+)
+
+// compatibleVersion is the redis version reported to clients, the commands follow its behaviors
+const compatibleVersion = "7.0.0"
+
+var (
+	errProtoNotInteger = errors.New("ERR Protocol version is not an integer or out of range")
+	errNoProto         = errors.New("NOPROTO unsupported protocol version")
+	errWrongPass       = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	errClientName      = errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
+)
+
+// connectionCommands returns the commands about the connection and the server itself
+func connectionCommands() []*Command {
+	return []*Command{
+		{Name: "ping", Arity: -1, Flags: FlagFast, Func: ping},
+		{Name: "echo", Arity: 2, Flags: FlagFast, Func: echo},
+		{Name: "quit", Arity: -1, Flags: FlagFast, Func: quit},
+		{Name: "command", Arity: -1, Func: command},
+		{Name: "hello", Arity: -1, Flags: FlagFast, Func: hello},
+	}
+}
+
+// PING [message]
+func ping(req *Request, writer *resproto3.RespWriter) error {
+	switch len(req.Args) {
+	case 1:
+		return writer.WriteStatus("PONG")
+	case 2:
+		return writer.WriteBulk(req.Args[1])
+	default:
+		return writer.WriteError(wrongArityError(req.Command.Name))
+	}
+}
+
+// ECHO message
+func echo(req *Request, writer *resproto3.RespWriter) error {
+	return writer.WriteBulk(req.Args[1])
+}
+
+// QUIT
+func quit(req *Request, writer *resproto3.RespWriter) error {
+	if err := writer.WriteStatus("OK"); err != nil {
+		return err
+	}
+	return errQuit
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]], it switches the protocol of
+// the following replies, including its own reply.
+func hello(req *Request, writer *resproto3.RespWriter) error {
+	proto := req.Session.proto
+	next := 1
+	if len(req.Args) >= 2 {
+		v, ok := parseInt(req.Args[1])
+		if !ok {
+			return writer.WriteError(errProtoNotInteger)
+		} else if v != int64(resproto3.Resp2) && v != int64(resproto3.Resp3) {
+			return writer.WriteError(errNoProto)
+		}
+		proto = resproto3.Version(v)
+		next++
+	}
+
+	var name []byte
+	var setName bool
+	for i := next; i < len(req.Args); i++ {
+		more := len(req.Args) - 1 - i
+		switch option := strings.ToLower(string(req.Args[i])); {
+		case option == "auth" && more >= 2:
+			// there are no users except the default one without password
+			if string(req.Args[i+1]) != "default" {
+				return writer.WriteError(errWrongPass)
+			}
+			i += 2
+		case option == "setname" && more >= 1:
+			name, setName = req.Args[i+1], true
+			if !validClientName(name) {
+				return writer.WriteError(errClientName)
+			}
+			i++
+		default:
+			return writer.WriteError(fmt.Errorf("ERR Syntax error in HELLO option '%s'", req.Args[i]))
+		}
+	}
+
+	if setName {
+		req.Client.SetName(string(name))
+	}
+	req.Session.proto = proto
+	if err := writer.SetVersion(proto); err != nil {
+		return err
+	}
+
+	fields := []struct {
+		name  string
+		value any
+	}{
+		{"server", "redis"},
+		{"version", compatibleVersion},
+		{"proto", int64(proto)},
+		{"id", int64(req.Client.ID())},
+		{"mode", "standalone"},
+		{"role", "master"},
+		{"modules", nil},
+	}
+	if err := writer.WriteMapHeader(len(fields)); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if err := writer.WriteBulkString(field.name); err != nil {
+			return err
+		}
+
+		var err error
+		switch v := field.value.(type) {
+		case string:
+			err = writer.WriteBulkString(v)
+		case int64:
+			err = writer.WriteInteger(v)
+		default:
+			// no modules
+			err = writer.WriteArrayHeader(0)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validClientName reports whether the name only contains printable characters without spaces, empty name is allowed
+func validClientName(name []byte) bool {
+	for _, c := range name {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// COMMAND [COUNT | LIST | INFO command-name [command-name ...]]
+func command(req *Request, writer *resproto3.RespWriter) error {
+	if len(req.Args) == 1 {
+		cmds := req.registry.Commands()
+		if err := writer.WriteArrayHeader(len(cmds)); err != nil {
+			return err
+		}
+		for _, cmd := range cmds {
+			if err := writeCommandInfo(writer, cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	sub := strings.ToLower(string(req.Args[1]))
+	switch sub {
+	case "count":
+		if len(req.Args) != 2 {
+			return writer.WriteError(wrongArityError("command|count"))
+		}
+		return writer.WriteInteger(int64(req.registry.Len()))
+	case "list":
+		if len(req.Args) != 2 {
+			return writer.WriteError(wrongArityError("command|list"))
+		}
+		cmds := req.registry.Commands()
+		if err := writer.WriteArrayHeader(len(cmds)); err != nil {
+			return err
+		}
+		for _, cmd := range cmds {
+			if err := writer.WriteBulkString(cmd.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "info":
+		names := req.Args[2:]
+		if err := writer.WriteArrayHeader(len(names)); err != nil {
+			return err
+		}
+		for _, name := range names {
+			cmd, ok := req.registry.Lookup(name)
+			if !ok {
+				if err := writer.WriteNullArray(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := writeCommandInfo(writer, cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return writer.WriteError(unknownSubcommandError(req.Command.Name, req.Args[1]))
+	}
+}
+
+// writeCommandInfo writes name, arity, flags, first key, last key and step of the command
+func writeCommandInfo(writer *resproto3.RespWriter, cmd *Command) error {
+	if err := writer.WriteArrayHeader(6); err != nil {
+		return err
+	}
+	if err := writer.WriteBulkString(cmd.Name); err != nil {
+		return err
+	}
+	if err := writer.WriteInteger(int64(cmd.Arity)); err != nil {
+		return err
+	}
+
+	flags := cmd.Flags.Names()
+	if err := writer.WriteArrayHeader(len(flags)); err != nil {
+		return err
+	}
+	for _, flag := range flags {
+		if err := writer.WriteStatus(flag); err != nil {
+			return err
+		}
+	}
+
+	for _, pos := range []int{cmd.FirstKey, cmd.LastKey, cmd.Step} {
+		if err := writer.WriteInteger(int64(pos)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"github.com/246859/codis/pkg/util/glob"
+	"github.com/246859/codis/redis/datastruct/dict"
+	"sync/atomic"
+)
+
+// DB is a logical database, each method is safe for concurrent use and atomic by itself, the commands reading
+// and modifying the keys in multiple steps should hold the locks of the keys by LockKeys. The expired keys are
+// removed lazily when they are accessed.
+type DB struct {
+	index int
+	// swapped by SWAPDB and FLUSHDB while holding all the key locks
+	data  atomic.Pointer[dict.ConcurrentDict[*Object]]
+	locks *dict.Locks
+}
+
+func newDB(index int) *DB {
+	db := &DB{index: index, locks: dict.NewLocks(dict.DefaultLocks)}
+	db.data.Store(dict.New[*Object](dict.DefaultShards))
+	return db
+}
+
+// Index returns the index of database in the keyspace
+func (db *DB) Index() int {
+	return db.index
+}
+
+func (db *DB) dict() *dict.ConcurrentDict[*Object] {
+	return db.data.Load()
+}
+
+// Lock locks the key for writing
+func (db *DB) Lock(key string) {
+	db.locks.Lock(key)
+}
+
+func (db *DB) Unlock(key string) {
+	db.locks.Unlock(key)
+}
+
+// RLock locks the key for reading
+func (db *DB) RLock(key string) {
+	db.locks.RLock(key)
+}
+
+func (db *DB) RUnlock(key string) {
+	db.locks.RUnlock(key)
+}
+
+// LockKeys locks writeKeys for writing and readKeys for reading in a deadlock-free order,
+// it returns the function to unlock them.
+func (db *DB) LockKeys(writeKeys, readKeys []string) (unlock func()) {
+	return db.locks.LockKeys(writeKeys, readKeys)
+}
+
+// Get returns the object of key, the expired key is removed and treated as absent
+func (db *DB) Get(key string) (*Object, bool) {
+	obj, ok := db.dict().Get(key)
+	if !ok {
+		return nil, false
+	} else if obj.expired(nowMilli()) {
+		db.expire(key, obj)
+		return nil, false
+	}
+	return obj, true
+}
+
+// expire removes the expired object, unless the key has been set to another object concurrently
+func (db *DB) expire(key string, obj *Object) {
+	db.dict().DeleteIf(key, func(v *Object) bool {
+		return v == obj
+	})
+}
+
+// Lookup returns the object of key if it has the type, nil if the key does not exist, ErrWrongType if
+// the key holds another type.
+func (db *DB) Lookup(key string, typ Type) (*Object, error) {
+	obj, ok := db.Get(key)
+	if !ok {
+		return nil, nil
+	} else if obj.Type != typ {
+		return nil, ErrWrongType
+	}
+	return obj, nil
+}
+
+// Set stores the object, the old value of key is overwritten regardless of its type and expiration
+func (db *DB) Set(key string, obj *Object) {
+	db.dict().Set(key, obj)
+}
+
+// Delete removes the key, returns false if it does not exist
+func (db *DB) Delete(key string) bool {
+	obj, ok := db.dict().Delete(key)
+	return ok && !obj.expired(nowMilli())
+}
+
+func (db *DB) Exists(key string) bool {
+	_, ok := db.Get(key)
+	return ok
+}
+
+// Len returns the number of keys, including the expired keys not removed yet
+func (db *DB) Len() int {
+	return db.dict().Len()
+}
+
+// Keys returns the keys matching the glob-style pattern
+func (db *DB) Keys(pattern string) []string {
+	var keys []string
+	all, now := pattern == "*", nowMilli()
+	db.dict().ForEach(func(key string, obj *Object) bool {
+		if obj.expired(now) {
+			db.expire(key, obj)
+		} else if all || glob.Match(pattern, key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// RandomKey returns a random key, false if the database is empty
+func (db *DB) RandomKey() (string, bool) {
+	// give up after some tries if most keys are expired
+	for i := 0; i < 100; i++ {
+		key, ok := db.dict().RandomKey()
+		if !ok {
+			return "", false
+		} else if db.Exists(key) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Rename moves the value of src to dst, the old value of dst is overwritten, returns false if src does not exist,
+// the caller should hold the locks of both keys.
+func (db *DB) Rename(src, dst string) bool {
+	obj, ok := db.dict().Delete(src)
+	if !ok || obj.expired(nowMilli()) {
+		return false
+	}
+	db.dict().Set(dst, obj)
+	return true
+}
+
+// Flush removes all the keys, it excludes all the commands holding the key locks, so they see the database
+// either before or after the flush.
+func (db *DB) Flush() {
+	db.locks.LockAll()
+	defer db.locks.UnlockAll()
+	db.data.Store(dict.New[*Object](dict.DefaultShards))
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"errors"
+	"github.com/246859/codis/redis/datastruct/dict"
+)
+
+// DefaultDatabases is the number of databases by default
+const DefaultDatabases = 16
+
+var (
+	ErrDBIndexOutOfRange = errors.New("ERR DB index is out of range")
+	ErrSameObject        = errors.New("ERR source and destination objects are the same")
+)
+
+// Keyspace holds a fixed number of logical databases, the methods operating on multiple databases
+// lock the keys in the order of database index, so they must not be called with any key locked.
+type Keyspace struct {
+	dbs []*DB
+}
+
+// NewKeyspace returns a keyspace with the number of empty databases
+func NewKeyspace(databases int) *Keyspace {
+	dbs := make([]*DB, databases)
+	for i := range dbs {
+		dbs[i] = newDB(i)
+	}
+	return &Keyspace{dbs: dbs}
+}
+
+// Len returns the number of databases
+func (k *Keyspace) Len() int {
+	return len(k.dbs)
+}
+
+// DB returns the database of index
+func (k *Keyspace) DB(index int) (*DB, error) {
+	if index < 0 || index >= len(k.dbs) {
+		return nil, ErrDBIndexOutOfRange
+	}
+	return k.dbs[index], nil
+}
+
+// SwapDB swaps the data of two databases, the clients selected one of them see the data of the other immediately
+func (k *Keyspace) SwapDB(i, j int) error {
+	if _, err := k.DB(i); err != nil {
+		return err
+	} else if _, err := k.DB(j); err != nil {
+		return err
+	} else if i == j {
+		return nil
+	}
+
+	// exclude all the commands on both databases
+	first, second := k.dbs[min(i, j)], k.dbs[max(i, j)]
+	first.locks.LockAll()
+	second.locks.LockAll()
+	defer first.locks.UnlockAll()
+	defer second.locks.UnlockAll()
+
+	data := first.data.Load()
+	first.data.Store(second.data.Load())
+	second.data.Store(data)
+	return nil
+}
+
+// Move moves the key from src database to dst database, returns false if the key does not exist in src
+// or already exists in dst.
+func (k *Keyspace) Move(key string, src, dst int) (bool, error) {
+	if _, err := k.DB(src); err != nil {
+		return false, err
+	} else if _, err := k.DB(dst); err != nil {
+		return false, err
+	} else if src == dst {
+		return false, ErrSameObject
+	}
+
+	from, to := k.dbs[src], k.dbs[dst]
+	first, second := from, to
+	if src > dst {
+		first, second = to, from
+	}
+	first.Lock(key)
+	second.Lock(key)
+	defer first.Unlock(key)
+	defer second.Unlock(key)
+
+	obj, ok := from.Get(key)
+	if !ok || to.Exists(key) {
+		return false, nil
+	}
+	to.Set(key, obj)
+	from.Delete(key)
+	return true, nil
+}
+
+// FlushAll removes all the keys of all the databases at once
+func (k *Keyspace) FlushAll() {
+	for _, db := range k.dbs {
+		db.locks.LockAll()
+		defer db.locks.UnlockAll()
+	}
+	for _, db := range k.dbs {
+		db.data.Store(dict.New[*Object](dict.DefaultShards))
+	}
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// Type is the type of value stored in the keyspace
+type Type uint8
+
+const (
+	TypeString Type = iota
+	TypeList
+	TypeHash
+	TypeSet
+	TypeZSet
+)
+
+// String returns the name of type as TYPE command replies
+func (t Type) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeList:
+		return "list"
+	case TypeHash:
+		return "hash"
+	case TypeSet:
+		return "set"
+	case TypeZSet:
+		return "zset"
+	default:
+		return "unknown"
+	}
+}
+
+// Object is a value in the keyspace, the concrete type of Value is decided by Type. The immutable values
+// like strings are replaced by new objects instead of being modified, so they can be read without locks.
+type Object struct {
+	Type  Type
+	Value any
+	// unix time in milliseconds when the key expires, 0 means never
+	expireAt atomic.Int64
+}
+
+// NewObject returns an object of the type
+func NewObject(typ Type, value any) *Object {
+	return &Object{Type: typ, Value: value}
+}
+
+// ExpireAt returns the unix time in milliseconds when the key expires, 0 means never
+func (o *Object) ExpireAt() int64 {
+	return o.expireAt.Load()
+}
+
+// SetExpireAt sets the expiration time in unix milliseconds, 0 removes it
+func (o *Object) SetExpireAt(ms int64) {
+	o.expireAt.Store(ms)
+}
+
+func (o *Object) expired(now int64) bool {
+	at := o.expireAt.Load()
+	return at != 0 && at <= now
+}
+
+func nowMilli() int64 {
+	return time.Now().UnixMilli()
+}
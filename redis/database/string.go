@@ -0,0 +1,63 @@
+package database
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// NewString returns a string object holding a copy of b, the canonical integers like "123" are stored
+// as int64, which saves memory and parsing for counters.
+func NewString(b []byte) *Object {
+	if n, ok := canonicalInt(b); ok {
+		return NewInteger(n)
+	}
+	return NewObject(TypeString, bytes.Clone(b))
+}
+
+// NewInteger returns an integer encoded string object
+func NewInteger(n int64) *Object {
+	return NewObject(TypeString, n)
+}
+
+// canonicalInt reports whether b is the decimal form of an int64 without redundant characters,
+// e.g. "+1", "01" and "-0" are not, so the integer can be formatted back to the same string.
+func canonicalInt(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 20 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	var buf [20]byte
+	return n, bytes.Equal(strconv.AppendInt(buf[:0], n, 10), b)
+}
+
+// StringBytes returns the bytes of string object, the returned slice must not be modified
+func (o *Object) StringBytes() []byte {
+	switch v := o.Value.(type) {
+	case int64:
+		return strconv.AppendInt(nil, v, 10)
+	case []byte:
+		return v
+	}
+	return nil
+}
+
+// StringInt returns the value of integer encoded string object
+func (o *Object) StringInt() (int64, bool) {
+	n, ok := o.Value.(int64)
+	return n, ok
+}
+
+// StringLen returns the length of string object
+func (o *Object) StringLen() int {
+	switch v := o.Value.(type) {
+	case int64:
+		var buf [20]byte
+		return len(strconv.AppendInt(buf[:0], v, 10))
+	case []byte:
+		return len(v)
+	}
+	return 0
+}
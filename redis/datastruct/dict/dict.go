@@ -0,0 +1,199 @@
+package dict
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultShards is the number of shards by default
+const DefaultShards = 256
+
+// ConcurrentDict is a hash map split into lock-striped shards, the operations on the keys in different
+// shards run in parallel. Each method is atomic by itself, combine them with Locks for read-modify-write.
+type ConcurrentDict[V any] struct {
+	shards []*shard[V]
+	mask   uint32
+	count  atomic.Int64
+}
+
+type shard[V any] struct {
+	mu sync.RWMutex
+	m  map[string]V
+}
+
+// New returns a dict with the number of shards rounded up to a power of two
+func New[V any](shards int) *ConcurrentDict[V] {
+	n := roundPowerOfTwo(shards)
+	d := &ConcurrentDict[V]{shards: make([]*shard[V], n), mask: uint32(n - 1)}
+	for i := range d.shards {
+		d.shards[i] = &shard[V]{m: make(map[string]V)}
+	}
+	return d
+}
+
+func roundPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// fnv32 is the inlined FNV-1a hash, it does not allocate like hash/fnv
+func fnv32(key string) uint32 {
+	const prime32 = 16777619
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+	return hash
+}
+
+func (d *ConcurrentDict[V]) shardOf(key string) *shard[V] {
+	return d.shards[fnv32(key)&d.mask]
+}
+
+func (d *ConcurrentDict[V]) Get(key string) (V, bool) {
+	s := d.shardOf(key)
+	s.mu.RLock()
+	v, ok := s.m[key]
+	s.mu.RUnlock()
+	return v, ok
+}
+
+// Set stores the value, returns true if the key is new
+func (d *ConcurrentDict[V]) Set(key string, v V) bool {
+	s := d.shardOf(key)
+	s.mu.Lock()
+	_, exists := s.m[key]
+	s.m[key] = v
+	s.mu.Unlock()
+
+	if !exists {
+		d.count.Add(1)
+	}
+	return !exists
+}
+
+// SetIfAbsent stores the value only if the key does not exist, returns true if stored
+func (d *ConcurrentDict[V]) SetIfAbsent(key string, v V) bool {
+	s := d.shardOf(key)
+	s.mu.Lock()
+	_, exists := s.m[key]
+	if !exists {
+		s.m[key] = v
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		d.count.Add(1)
+	}
+	return !exists
+}
+
+// Delete removes the key and returns its value, false if it does not exist
+func (d *ConcurrentDict[V]) Delete(key string) (V, bool) {
+	s := d.shardOf(key)
+	s.mu.Lock()
+	v, exists := s.m[key]
+	if exists {
+		delete(s.m, key)
+	}
+	s.mu.Unlock()
+
+	if exists {
+		d.count.Add(-1)
+	}
+	return v, exists
+}
+
+// DeleteIf removes the key if fn returns true for its value, fn is called under the lock of shard, so it must not
+// access the dict. It is used to remove a value only if it is not replaced concurrently.
+func (d *ConcurrentDict[V]) DeleteIf(key string, fn func(v V) bool) bool {
+	s := d.shardOf(key)
+	s.mu.Lock()
+	v, exists := s.m[key]
+	deleted := exists && fn(v)
+	if deleted {
+		delete(s.m, key)
+	}
+	s.mu.Unlock()
+
+	if deleted {
+		d.count.Add(-1)
+	}
+	return deleted
+}
+
+// Len returns the number of keys
+func (d *ConcurrentDict[V]) Len() int {
+	return int(d.count.Load())
+}
+
+// ForEach calls fn for the keys until it returns false. The shards are visited one by one, each shard is copied
+// under its read lock then fn is called without holding the lock, so fn can modify the dict, the keys added or
+// removed concurrently may or may not be visited.
+func (d *ConcurrentDict[V]) ForEach(fn func(key string, v V) bool) {
+	type entry struct {
+		key string
+		v   V
+	}
+	var entries []entry
+
+	for _, s := range d.shards {
+		s.mu.RLock()
+		entries = entries[:0]
+		for key, v := range s.m {
+			entries = append(entries, entry{key, v})
+		}
+		s.mu.RUnlock()
+
+		for _, e := range entries {
+			if !fn(e.key, e.v) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns all the keys
+func (d *ConcurrentDict[V]) Keys() []string {
+	keys := make([]string, 0, d.Len())
+	d.ForEach(func(key string, _ V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// RandomKey returns a random key, false if the dict is empty
+func (d *ConcurrentDict[V]) RandomKey() (string, bool) {
+	if d.Len() == 0 {
+		return "", false
+	}
+
+	start := rand.Intn(len(d.shards))
+	for i := range d.shards {
+		s := d.shards[(start+i)&int(d.mask)]
+		s.mu.RLock()
+		// the iteration of map starts at a random position
+		for key := range s.m {
+			s.mu.RUnlock()
+			return key, true
+		}
+		s.mu.RUnlock()
+	}
+	return "", false
+}
+
+// Clear removes all the keys shard by shard
+func (d *ConcurrentDict[V]) Clear() {
+	for _, s := range d.shards {
+		s.mu.Lock()
+		d.count.Add(-int64(len(s.m)))
+		s.m = make(map[string]V)
+		s.mu.Unlock()
+	}
+}
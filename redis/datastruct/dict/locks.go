@@ -0,0 +1,113 @@
+package dict
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultLocks is the number of lock stripes by default
+const DefaultLocks = 1024
+
+// Locks is a table of striped locks for the keys, it makes the commands reading and modifying
+// multiple keys atomic. The keys are hashed into the stripes, the multi-key methods lock the stripes
+// in ascending order so that they never deadlock with each other.
+type Locks struct {
+	stripes []sync.RWMutex
+	mask    uint32
+}
+
+// NewLocks returns a lock table with the number of stripes rounded up to a power of two
+func NewLocks(stripes int) *Locks {
+	n := roundPowerOfTwo(stripes)
+	return &Locks{stripes: make([]sync.RWMutex, n), mask: uint32(n - 1)}
+}
+
+func (l *Locks) index(key string) uint32 {
+	return fnv32(key) & l.mask
+}
+
+func (l *Locks) Lock(key string) {
+	l.stripes[l.index(key)].Lock()
+}
+
+func (l *Locks) Unlock(key string) {
+	l.stripes[l.index(key)].Unlock()
+}
+
+func (l *Locks) RLock(key string) {
+	l.stripes[l.index(key)].RLock()
+}
+
+func (l *Locks) RUnlock(key string) {
+	l.stripes[l.index(key)].RUnlock()
+}
+
+// stripe is a stripe to lock, it is locked for writing if any of its keys is written
+type stripe struct {
+	index uint32
+	write bool
+}
+
+// stripesOf returns the distinct stripes of keys in ascending order
+func (l *Locks) stripesOf(writeKeys, readKeys []string) []stripe {
+	stripes := make([]stripe, 0, len(writeKeys)+len(readKeys))
+	for _, key := range writeKeys {
+		stripes = append(stripes, stripe{index: l.index(key), write: true})
+	}
+	for _, key := range readKeys {
+		stripes = append(stripes, stripe{index: l.index(key)})
+	}
+	sort.Slice(stripes, func(i, j int) bool {
+		if stripes[i].index != stripes[j].index {
+			return stripes[i].index < stripes[j].index
+		}
+		// the write one first, so it is kept in deduplication
+		return stripes[i].write && !stripes[j].write
+	})
+
+	n := 0
+	for i, s := range stripes {
+		if i > 0 && s.index == stripes[n-1].index {
+			continue
+		}
+		stripes[n] = s
+		n++
+	}
+	return stripes[:n]
+}
+
+// LockKeys locks writeKeys for writing and readKeys for reading, the same key may appear in both, it returns
+// the function to unlock them.
+func (l *Locks) LockKeys(writeKeys, readKeys []string) (unlock func()) {
+	stripes := l.stripesOf(writeKeys, readKeys)
+	for _, s := range stripes {
+		if s.write {
+			l.stripes[s.index].Lock()
+		} else {
+			l.stripes[s.index].RLock()
+		}
+	}
+
+	return func() {
+		for i := len(stripes) - 1; i >= 0; i-- {
+			if stripes[i].write {
+				l.stripes[stripes[i].index].Unlock()
+			} else {
+				l.stripes[stripes[i].index].RUnlock()
+			}
+		}
+	}
+}
+
+// LockAll locks all the stripes for writing, it excludes all the other holders
+func (l *Locks) LockAll() {
+	for i := range l.stripes {
+		l.stripes[i].Lock()
+	}
+}
+
+func (l *Locks) UnlockAll() {
+	for i := len(l.stripes) - 1; i >= 0; i-- {
+		l.stripes[i].Unlock()
+	}
+}
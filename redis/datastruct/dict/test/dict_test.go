@@ -0,0 +1,193 @@
+package test
+
+import (
+	"github.com/246859/codis/redis/datastruct/dict"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConcurrentDict(t *testing.T) {
+	d := dict.New[int](10)
+
+	if !d.Set("a", 1) || d.Set("a", 2) {
+		t.Error("expected Set reports whether the key is new")
+	}
+	if d.SetIfAbsent("a", 3) || !d.SetIfAbsent("b", 3) {
+		t.Error("expected SetIfAbsent only stores the absent key")
+	}
+	if v, ok := d.Get("a"); !ok || v != 2 {
+		t.Errorf("expected 2, got %d %v", v, ok)
+	}
+	if d.Len() != 2 {
+		t.Errorf("expected 2 keys, got %d", d.Len())
+	}
+
+	if v, ok := d.Delete("a"); !ok || v != 2 {
+		t.Errorf("expected deleted 2, got %d %v", v, ok)
+	}
+	if _, ok := d.Delete("a"); ok {
+		t.Error("expected the deleted key not found")
+	}
+	if key, ok := d.RandomKey(); !ok || key != "b" {
+		t.Errorf("expected random key b, got %q %v", key, ok)
+	}
+
+	d.Clear()
+	if _, ok := d.RandomKey(); ok || d.Len() != 0 {
+		t.Errorf("expected empty after Clear, got %d keys", d.Len())
+	}
+}
+
+func TestConcurrentDict_ForEach(t *testing.T) {
+	d := dict.New[int](dict.DefaultShards)
+	for i := 0; i < 1000; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+
+	// modifying the dict in the callback does not deadlock
+	visited := 0
+	d.ForEach(func(key string, v int) bool {
+		visited++
+		d.Delete(key)
+		d.Set("new"+key, v)
+		return true
+	})
+	if visited < 1000 {
+		t.Errorf("expected all the existing keys visited, got %d", visited)
+	}
+	if d.Len() != 1000 || len(d.Keys()) != 1000 {
+		t.Errorf("expected 1000 keys, got %d", d.Len())
+	}
+
+	stopped := 0
+	d.ForEach(func(key string, v int) bool {
+		stopped++
+		return stopped < 10
+	})
+	if stopped != 10 {
+		t.Errorf("expected iteration stopped, got %d", stopped)
+	}
+}
+
+func TestLocks_LockKeys(t *testing.T) {
+	locks := dict.NewLocks(16)
+	d := dict.New[int](16)
+
+	// transfer between the keys in different orders concurrently, the ordered locking must not deadlock
+	// and the total must be kept
+	keys := []string{"a", "b", "c", "d", "e"}
+	for _, key := range keys {
+		d.Set(key, 100)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				from, to := keys[(g+i)%len(keys)], keys[(g+i*3+1)%len(keys)]
+				unlock := locks.LockKeys([]string{to, from}, []string{from})
+				a, _ := d.Get(from)
+				b, _ := d.Get(to)
+				if from != to {
+					d.Set(from, a-1)
+					d.Set(to, b+1)
+				}
+				unlock()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, key := range keys {
+		v, _ := d.Get(key)
+		total += v
+	}
+	if total != 500 {
+		t.Errorf("expected total 500, got %d", total)
+	}
+
+	locks.LockAll()
+	locks.UnlockAll()
+}
+
+const benchKeys = 1 << 16
+
+// mutexMap is a map guarded by a single lock, the baseline
+type mutexMap struct {
+	mu sync.RWMutex
+	m  map[string]int
+}
+
+func (m *mutexMap) Get(key string) (int, bool) {
+	m.mu.RLock()
+	v, ok := m.m[key]
+	m.mu.RUnlock()
+	return v, ok
+}
+
+func (m *mutexMap) Set(key string, v int) {
+	m.mu.Lock()
+	m.m[key] = v
+	m.mu.Unlock()
+}
+
+func benchKeySet() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// benchMixed runs the parallel workload with a write every writeEvery operations
+func benchMixed(b *testing.B, writeEvery int, get func(string), set func(string, int)) {
+	keys := benchKeySet()
+	for i, key := range keys {
+		set(key, i)
+	}
+
+	var seed atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(seed.Add(1)) * 7919
+		for pb.Next() {
+			key := keys[i&(benchKeys-1)]
+			if i%writeEvery == 0 {
+				set(key, i)
+			} else {
+				get(key)
+			}
+			i++
+		}
+	})
+}
+
+func benchmarkDicts(b *testing.B, writeEvery int) {
+	b.Run("ConcurrentDict", func(b *testing.B) {
+		d := dict.New[int](dict.DefaultShards)
+		benchMixed(b, writeEvery, func(key string) { d.Get(key) }, func(key string, v int) { d.Set(key, v) })
+	})
+	b.Run("SyncMap", func(b *testing.B) {
+		var m sync.Map
+		benchMixed(b, writeEvery, func(key string) { m.Load(key) }, func(key string, v int) { m.Store(key, v) })
+	})
+	b.Run("MutexMap", func(b *testing.B) {
+		m := &mutexMap{m: make(map[string]int)}
+		benchMixed(b, writeEvery, func(key string) { m.Get(key) }, func(key string, v int) { m.Set(key, v) })
+	})
+}
+
+// BenchmarkDict_ReadHeavy 90% reads and 10% writes
+func BenchmarkDict_ReadHeavy(b *testing.B) {
+	benchmarkDicts(b, 10)
+}
+
+// BenchmarkDict_WriteHeavy 50% reads and 50% writes
+func BenchmarkDict_WriteHeavy(b *testing.B) {
+	benchmarkDicts(b, 2)
+}
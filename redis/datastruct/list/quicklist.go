@@ -0,0 +1,505 @@
+package list
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// maxNodeBytes is the max size of a node, the same as list-max-listpack-size -2 of redis,
+// the element larger than it is stored in a node by itself.
+const maxNodeBytes = 8 * 1024
+
+// QuickList is a doubly linked list of compact nodes, each node packs a run of elements into one
+// byte buffer, so the list has much fewer allocations and pointers than a list of elements, and
+// pushing or popping at both ends is O(1). It is not safe for concurrent use.
+//
+// An element in node buffer is encoded as uvarint(len) + data + backlen, backlen is the length of
+// the former two parts encoded backward, it allows to walk the node from the end.
+type QuickList struct {
+	head, tail *node
+	length     int
+}
+
+type node struct {
+	prev, next *node
+	buf        []byte
+	count      int
+}
+
+// New returns an empty list
+func New() *QuickList {
+	return &QuickList{}
+}
+
+// Len returns the number of elements
+func (l *QuickList) Len() int {
+	return l.length
+}
+
+// entrySize returns the encoded size of element of length n
+func entrySize(n int) int {
+	var tmp [binary.MaxVarintLen64]byte
+	size := binary.PutUvarint(tmp[:], uint64(n)) + n
+	return size + backlenSize(size)
+}
+
+func backlenSize(n int) int {
+	size := 1
+	for n >= 0x80 {
+		n >>= 7
+		size++
+	}
+	return size
+}
+
+// appendEntry encodes the element into dst
+func appendEntry(dst []byte, v []byte) []byte {
+	start := len(dst)
+	dst = binary.AppendUvarint(dst, uint64(len(v)))
+	dst = append(dst, v...)
+
+	// the lowest 7 bits are in the last byte, the high bit marks more bytes on the left
+	size := len(dst) - start
+	n := backlenSize(size)
+	for i := 0; i < n; i++ {
+		dst = append(dst, 0)
+	}
+	for i := 0; i < n; i++ {
+		b := byte(size & 0x7f)
+		if i < n-1 {
+			b |= 0x80
+		}
+		dst[len(dst)-1-i] = b
+		size >>= 7
+	}
+	return dst
+}
+
+// readEntry decodes the element at off, returns the element and the offset of next element
+func readEntry(buf []byte, off int) ([]byte, int) {
+	n, size := binary.Uvarint(buf[off:])
+	start := off + size
+	end := start + int(n)
+	return buf[start:end:end], end + backlenSize(end-off)
+}
+
+// prevEntry returns the offset of element which ends at end
+func prevEntry(buf []byte, end int) int {
+	var size, shift int
+	pos := end - 1
+	for {
+		b := buf[pos]
+		size |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		pos--
+	}
+	return pos - size
+}
+
+// offsetOf returns the offset of i-th element in node, walking from the nearer end
+func (n *node) offsetOf(i int) int {
+	if i <= n.count/2 {
+		off := 0
+		for ; i > 0; i-- {
+			_, off = readEntry(n.buf, off)
+		}
+		return off
+	}
+
+	off := len(n.buf)
+	for j := n.count; j > i; j-- {
+		off = prevEntry(n.buf, off)
+	}
+	return off
+}
+
+// fits reports whether an element of length size can be added into the node
+func (n *node) fits(size int) bool {
+	return n.count == 0 || len(n.buf)+entrySize(size) <= maxNodeBytes
+}
+
+// insertAt inserts the element at the offset of node
+func (n *node) insertAt(off int, v []byte) {
+	size := entrySize(len(v))
+	n.buf = append(n.buf, make([]byte, size)...)
+	copy(n.buf[off+size:], n.buf[off:len(n.buf)-size])
+	appendEntry(n.buf[:off], v)
+	n.count++
+}
+
+// removeAt removes the element at the offset of node
+func (n *node) removeAt(off int) {
+	_, next := readEntry(n.buf, off)
+	n.buf = append(n.buf[:off], n.buf[next:]...)
+	n.count--
+}
+
+func (l *QuickList) linkAfter(prev, n *node) {
+	n.prev = prev
+	if prev == nil {
+		n.next = l.head
+		l.head = n
+	} else {
+		n.next = prev.next
+		prev.next = n
+	}
+	if n.next == nil {
+		l.tail = n
+	} else {
+		n.next.prev = n
+	}
+}
+
+func (l *QuickList) unlink(n *node) {
+	if n.prev == nil {
+		l.head = n.next
+	} else {
+		n.prev.next = n.next
+	}
+	if n.next == nil {
+		l.tail = n.prev
+	} else {
+		n.next.prev = n.prev
+	}
+	n.prev, n.next = nil, nil
+}
+
+// PushFront inserts the copy of element at the head
+func (l *QuickList) PushFront(v []byte) {
+	if l.head == nil || !l.head.fits(len(v)) {
+		l.linkAfter(nil, &node{})
+	}
+	l.head.insertAt(0, v)
+	l.length++
+}
+
+// PushBack inserts the copy of element at the tail
+func (l *QuickList) PushBack(v []byte) {
+	if l.tail == nil || !l.tail.fits(len(v)) {
+		l.linkAfter(l.tail, &node{})
+	}
+	l.tail.buf = appendEntry(l.tail.buf, v)
+	l.tail.count++
+	l.length++
+}
+
+// PopFront removes the head element and returns it
+func (l *QuickList) PopFront() ([]byte, bool) {
+	if l.head == nil {
+		return nil, false
+	}
+	v, _ := readEntry(l.head.buf, 0)
+	v = bytes.Clone(v)
+	l.removeAt(l.head, 0)
+	return v, true
+}
+
+// PopBack removes the tail element and returns it
+func (l *QuickList) PopBack() ([]byte, bool) {
+	if l.tail == nil {
+		return nil, false
+	}
+	off := prevEntry(l.tail.buf, len(l.tail.buf))
+	v, _ := readEntry(l.tail.buf, off)
+	v = bytes.Clone(v)
+	l.removeAt(l.tail, off)
+	return v, true
+}
+
+// removeAt removes the element at offset of the node, the empty node is unlinked
+func (l *QuickList) removeAt(n *node, off int) {
+	n.removeAt(off)
+	l.length--
+	if n.count == 0 {
+		l.unlink(n)
+	}
+}
+
+// normalize converts the negative index counting from the tail, returns false if it is out of range
+func (l *QuickList) normalize(i int) (int, bool) {
+	if i < 0 {
+		i += l.length
+	}
+	return i, i >= 0 && i < l.length
+}
+
+// locate returns the node and the offset of the element at index, which must be in range
+func (l *QuickList) locate(i int) (*node, int) {
+	if i < l.length/2 {
+		n := l.head
+		for i >= n.count {
+			i -= n.count
+			n = n.next
+		}
+		return n, n.offsetOf(i)
+	}
+
+	n, rest := l.tail, l.length-1-i
+	for rest >= n.count {
+		rest -= n.count
+		n = n.prev
+	}
+	return n, n.offsetOf(n.count - 1 - rest)
+}
+
+// Index returns the element at index, the negative index counts from the tail, e.g. -1 is the last one.
+// The returned slice is only valid until the list is modified.
+func (l *QuickList) Index(i int) ([]byte, bool) {
+	i, ok := l.normalize(i)
+	if !ok {
+		return nil, false
+	}
+	n, off := l.locate(i)
+	v, _ := readEntry(n.buf, off)
+	return v, true
+}
+
+// Set replaces the element at index, returns false if the index is out of range
+func (l *QuickList) Set(i int, v []byte) bool {
+	i, ok := l.normalize(i)
+	if !ok {
+		return false
+	}
+	n, off := l.locate(i)
+	n.removeAt(off)
+	l.length--
+	l.insert(n, off, v)
+	return true
+}
+
+// insert inserts the element at the offset of node, the full node is split at the offset, and the element
+// is added into the neighbor node or a new node if it does not fit either.
+func (l *QuickList) insert(n *node, off int, v []byte) {
+	l.length++
+	if n.fits(len(v)) {
+		n.insertAt(off, v)
+		return
+	}
+
+	if off != 0 && off != len(n.buf) {
+		// move the elements after the offset to a new node
+		tail := &node{buf: bytes.Clone(n.buf[off:])}
+		for o := 0; o < len(tail.buf); tail.count++ {
+			_, o = readEntry(tail.buf, o)
+		}
+		n.buf, n.count = n.buf[:off:off], n.count-tail.count
+		l.linkAfter(n, tail)
+	}
+
+	if off == 0 {
+		if n.prev == nil || !n.prev.fits(len(v)) {
+			l.linkAfter(n.prev, &node{})
+		}
+		n.prev.buf = appendEntry(n.prev.buf, v)
+		n.prev.count++
+	} else if n.fits(len(v)) {
+		n.buf = appendEntry(n.buf, v)
+		n.count++
+	} else {
+		if n.next == nil || !n.next.fits(len(v)) {
+			l.linkAfter(n, &node{})
+		}
+		n.next.insertAt(0, v)
+	}
+}
+
+// Range calls fn for the elements from start to stop inclusively until it returns false, the negative
+// indexes count from the tail and the out of range indexes are clamped. The elements are visited in
+// place without copying, they are only valid during the call.
+func (l *QuickList) Range(start, stop int, fn func(v []byte) bool) {
+	if start < 0 {
+		start = max(start+l.length, 0)
+	}
+	if stop < 0 {
+		stop += l.length
+	}
+	stop = min(stop, l.length-1)
+	if start > stop {
+		return
+	}
+
+	it := l.IteratorAt(start, false)
+	for i := start; i <= stop && it.Next(); i++ {
+		if !fn(it.Value()) {
+			return
+		}
+	}
+}
+
+// Trim keeps only the elements from start to stop inclusively, the indexes are handled as Range does
+func (l *QuickList) Trim(start, stop int) {
+	if start < 0 {
+		start = max(start+l.length, 0)
+	}
+	if stop < 0 {
+		stop += l.length
+	}
+	stop = min(stop, l.length-1)
+	if start > stop {
+		l.head, l.tail, l.length = nil, nil, 0
+		return
+	}
+
+	l.removeFront(start)
+	l.removeBack(l.length - (stop - start + 1))
+}
+
+// removeFront removes the first k elements, the whole nodes are dropped without decoding
+func (l *QuickList) removeFront(k int) {
+	for k > 0 && k >= l.head.count {
+		k -= l.head.count
+		l.length -= l.head.count
+		l.unlink(l.head)
+	}
+	if k > 0 {
+		off := l.head.offsetOf(k)
+		l.head.buf = append(l.head.buf[:0], l.head.buf[off:]...)
+		l.head.count -= k
+		l.length -= k
+	}
+}
+
+// removeBack removes the last k elements
+func (l *QuickList) removeBack(k int) {
+	for k > 0 && k >= l.tail.count {
+		k -= l.tail.count
+		l.length -= l.tail.count
+		l.unlink(l.tail)
+	}
+	if k > 0 {
+		l.tail.buf = l.tail.buf[:l.tail.offsetOf(l.tail.count-k)]
+		l.tail.count -= k
+		l.length -= k
+	}
+}
+
+// Insert inserts the element before or after the first element equal to pivot, returns false if the pivot
+// is not found.
+func (l *QuickList) Insert(pivot, v []byte, before bool) bool {
+	it := l.IteratorAt(0, false)
+	for it.Next() {
+		if bytes.Equal(it.Value(), pivot) {
+			if before {
+				l.insert(it.node, it.off, v)
+			} else {
+				l.insert(it.node, it.next, v)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Remove removes the elements equal to v, at most count ones from the head if count > 0, from the tail if
+// count < 0, or all of them if count is 0. It returns the number of removed elements.
+func (l *QuickList) Remove(v []byte, count int) int {
+	start, reverse := 0, false
+	if count < 0 {
+		start, reverse, count = -1, true, -count
+	}
+
+	removed := 0
+	it := l.IteratorAt(start, reverse)
+	for it.Next() {
+		if bytes.Equal(it.Value(), v) {
+			it.Remove()
+			removed++
+			if removed == count {
+				break
+			}
+		}
+	}
+	return removed
+}
+
+// Iterator walks the list from an index in either direction
+type Iterator struct {
+	list    *QuickList
+	reverse bool
+	node    *node
+	// offsets of the current element and the next one in node
+	off, next int
+	started   bool
+	// the current element has been removed, the offsets point to its neighbor
+	removed bool
+}
+
+// IteratorAt returns an iterator positioned before the element at index, the negative index counts from the tail,
+// the first Next moves to the element. The iterator is invalid once the list is modified except by its Remove.
+func (l *QuickList) IteratorAt(i int, reverse bool) *Iterator {
+	it := &Iterator{list: l, reverse: reverse}
+	if i, ok := l.normalize(i); ok {
+		it.node, it.off = l.locate(i)
+		_, it.next = readEntry(it.node.buf, it.off)
+	}
+	return it
+}
+
+// Next moves to the next element, returns false if there are no more elements
+func (it *Iterator) Next() bool {
+	if it.node == nil {
+		return false
+	} else if !it.started {
+		it.started = true
+		return true
+	}
+
+	if it.removed {
+		it.removed = false
+	} else if !it.reverse {
+		it.off = it.next
+		if it.off == len(it.node.buf) {
+			if it.node = it.node.next; it.node == nil {
+				return false
+			}
+			it.off = 0
+		}
+	} else {
+		if it.off == 0 {
+			if it.node = it.node.prev; it.node == nil {
+				return false
+			}
+			it.off = len(it.node.buf)
+		}
+		it.off = prevEntry(it.node.buf, it.off)
+	}
+
+	_, it.next = readEntry(it.node.buf, it.off)
+	return true
+}
+
+// Value returns the current element, it is only valid until the list is modified
+func (it *Iterator) Value() []byte {
+	v, _ := readEntry(it.node.buf, it.off)
+	return v
+}
+
+// Remove removes the current element, Next moves to the element after it
+func (it *Iterator) Remove() {
+	// the node is unlinked if it becomes empty, keep its neighbors
+	n, prev, next := it.node, it.node.prev, it.node.next
+	it.list.removeAt(n, it.off)
+
+	// find the neighbor in the walking direction, which becomes the current position for Next
+	switch {
+	case !it.reverse && it.off < len(n.buf):
+		// the next element is shifted to the offset
+	case !it.reverse:
+		it.node, it.off = next, 0
+	case it.off > 0:
+		it.off = prevEntry(n.buf, it.off)
+	default:
+		it.node = prev
+		if it.node != nil {
+			it.off = prevEntry(it.node.buf, len(it.node.buf))
+		}
+	}
+	it.removed = it.node != nil
+	if !it.removed {
+		// no more elements, make Next return false
+		it.started, it.node = true, nil
+	}
+}
@@ -0,0 +1,228 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/246859/codis/redis/datastruct/list"
+	"math/rand"
+	"testing"
+)
+
+// checkList compares the list with the model in both directions
+func checkList(t *testing.T, l *list.QuickList, model [][]byte) {
+	t.Helper()
+	if l.Len() != len(model) {
+		t.Fatalf("expected length %d, got %d", len(model), l.Len())
+	}
+
+	i := 0
+	l.Range(0, -1, func(v []byte) bool {
+		if !bytes.Equal(v, model[i]) {
+			t.Fatalf("index %d expected %q, got %q", i, model[i], v)
+		}
+		i++
+		return true
+	})
+	if i != len(model) {
+		t.Fatalf("expected %d elements visited, got %d", len(model), i)
+	}
+
+	it := l.IteratorAt(-1, true)
+	for i = len(model) - 1; it.Next(); i-- {
+		if !bytes.Equal(it.Value(), model[i]) {
+			t.Fatalf("reverse index %d expected %q, got %q", i, model[i], it.Value())
+		}
+	}
+	if i != -1 {
+		t.Fatalf("expected reverse iteration stops at -1, got %d", i)
+	}
+}
+
+func randomValue(r *rand.Rand) []byte {
+	size := r.Intn(20)
+	switch r.Intn(50) {
+	case 0:
+		// larger than a node
+		size = 9000 + r.Intn(1000)
+	case 1:
+		size = 200 + r.Intn(500)
+	}
+	v := make([]byte, size)
+	for i := range v {
+		v[i] = 'a' + byte(r.Intn(3))
+	}
+	return v
+}
+
+func TestQuickList_Model(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	l := list.New()
+	var model [][]byte
+
+	for step := 0; step < 20000; step++ {
+		op := r.Intn(10)
+		if len(model) < 100 && op > 6 {
+			op = 0
+		}
+
+		switch op {
+		case 0, 1:
+			v := randomValue(r)
+			l.PushBack(v)
+			model = append(model, v)
+		case 2:
+			v := randomValue(r)
+			l.PushFront(v)
+			model = append([][]byte{v}, model...)
+		case 3:
+			v, ok := l.PopFront()
+			if ok != (len(model) > 0) || ok && !bytes.Equal(v, model[0]) {
+				t.Fatalf("step %d: unexpected PopFront %q %v", step, v, ok)
+			}
+			if ok {
+				model = model[1:]
+			}
+		case 4:
+			v, ok := l.PopBack()
+			if ok != (len(model) > 0) || ok && !bytes.Equal(v, model[len(model)-1]) {
+				t.Fatalf("step %d: unexpected PopBack %q %v", step, v, ok)
+			}
+			if ok {
+				model = model[:len(model)-1]
+			}
+		case 5:
+			if len(model) == 0 {
+				continue
+			}
+			i, v := r.Intn(len(model)), randomValue(r)
+			if !l.Set(i-len(model)*r.Intn(2), v) {
+				t.Fatalf("step %d: Set %d out of range", step, i)
+			}
+			model[i] = v
+		case 6:
+			pivot, v, before := randomValue(r)[:0], randomValue(r), r.Intn(2) == 0
+			if len(model) > 0 {
+				pivot = model[r.Intn(len(model))]
+			}
+			found := -1
+			for i := range model {
+				if bytes.Equal(model[i], pivot) {
+					found = i
+					break
+				}
+			}
+			if l.Insert(pivot, v, before) != (found >= 0) {
+				t.Fatalf("step %d: unexpected Insert result", step)
+			}
+			if found >= 0 {
+				if !before {
+					found++
+				}
+				model = append(model[:found], append([][]byte{v}, model[found:]...)...)
+			}
+		case 7:
+			v, count := []byte("a"), r.Intn(5)-2
+			expected, removed := 0, 0
+			kept := model[:0:0]
+			if count >= 0 {
+				for _, e := range model {
+					if bytes.Equal(e, v) && (count == 0 || removed < count) {
+						removed++
+						continue
+					}
+					kept = append(kept, e)
+				}
+			} else {
+				for i := len(model) - 1; i >= 0; i-- {
+					if bytes.Equal(model[i], v) && removed < -count {
+						removed++
+						continue
+					}
+					kept = append([][]byte{model[i]}, kept...)
+				}
+			}
+			expected = removed
+			if n := l.Remove(v, count); n != expected {
+				t.Fatalf("step %d: expected %d removed, got %d", step, expected, n)
+			}
+			model = kept
+		case 8:
+			start, stop := r.Intn(10)-3, len(model)-r.Intn(10)
+			l.Trim(start, stop)
+			if start < 0 {
+				start = max(start+len(model), 0)
+			}
+			if stop < 0 {
+				stop += len(model)
+			}
+			stop = min(stop, len(model)-1)
+			if start > stop {
+				model = nil
+			} else {
+				model = model[start : stop+1]
+			}
+		case 9:
+			if len(model) == 0 {
+				continue
+			}
+			i := r.Intn(len(model))
+			if v, ok := l.Index(i); !ok || !bytes.Equal(v, model[i]) {
+				t.Fatalf("step %d: Index %d expected %q, got %q", step, i, model[i], v)
+			}
+			if v, ok := l.Index(i - len(model)); !ok || !bytes.Equal(v, model[i]) {
+				t.Fatalf("step %d: Index %d expected %q, got %q", step, i-len(model), model[i], v)
+			}
+		}
+
+		if step%100 == 0 {
+			checkList(t, l, model)
+		}
+	}
+	checkList(t, l, model)
+}
+
+func TestQuickList_Iterator(t *testing.T) {
+	l := list.New()
+	for i := 0; i < 5000; i++ {
+		l.PushBack([]byte(fmt.Sprint(i % 3)))
+	}
+
+	// remove all the "1" while walking backward across the nodes
+	it := l.IteratorAt(-1, true)
+	for it.Next() {
+		if string(it.Value()) == "1" {
+			it.Remove()
+		}
+	}
+	if l.Len() != 5000-1667 {
+		t.Fatalf("expected %d elements, got %d", 5000-1667, l.Len())
+	}
+
+	var r []byte
+	l.Range(-4, 100000, func(v []byte) bool {
+		r = append(r, v...)
+		return true
+	})
+	if string(r) != "2020" {
+		t.Errorf("unexpected tail %q", r)
+	}
+	if _, ok := l.Index(l.Len()); ok {
+		t.Error("expected out of range index not found")
+	}
+	if l.IteratorAt(l.Len(), false).Next() {
+		t.Error("expected iterator at out of range index is empty")
+	}
+}
+
+func BenchmarkQuickList_PushPop(b *testing.B) {
+	l := list.New()
+	v := []byte("hello world")
+	for i := 0; i < b.N; i++ {
+		l.PushBack(v)
+		l.PushFront(v)
+		if i%2 == 0 {
+			l.PopFront()
+			l.PopBack()
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"errors"
+	"github.com/246859/codis/coco"
+	"github.com/246859/codis/redis/resproto2"
+	"github.com/246859/codis/redis/resproto3"
+)
+
+// eventWriterSize is the buffer size of reply writer in event-loop mode, it is small because
+// coco.EventConn buffers the output itself.
+const eventWriterSize = 512
+
+// eventState is the state of a connection served in event-loop mode
+type eventState struct {
+	parser *resproto2.CommandParser
+	writer *resproto3.RespWriter
+	req    *Request
+	args   [][]byte
+}
+
+// OnOpen implements coco.EventHandler, the Handler can be served by coco.Server.ServeEvents too,
+// the commands are executed in the loops, so they must not block.
+func (h *Handler) OnOpen(conn *coco.EventConn) {
+	if h.closing.Load() {
+		conn.Close()
+		return
+	}
+
+	// RESP2 until the client switches the protocol by HELLO
+	writer := resproto3.NewRespWriterSize(conn, eventWriterSize)
+	session := &Session{proto: writer.Version()}
+	conn.SetValue(&eventState{
+		parser: resproto2.NewCommandParser(h.limits),
+		writer: writer,
+		req:    &Request{Client: conn, Session: session, Keyspace: h.keyspace},
+	})
+}
+
+// OnData executes the complete requests in data, and leaves the incomplete one for the following data
+func (h *Handler) OnData(conn *coco.EventConn, data []byte) (int, error) {
+	state, ok := conn.Value().(*eventState)
+	if !ok {
+		return len(data), nil
+	}
+	writer := state.writer
+
+	consumed := 0
+	for consumed < len(data) {
+		args, n, err := state.parser.Parse(data[consumed:], state.args)
+		if err != nil {
+			if resproto2.IsProtocolError(err) {
+				writer.WriteError(errors.New("ERR " + err.Error()))
+			}
+			writer.Flush()
+			return consumed, err
+		} else if n == 0 {
+			break
+		}
+		consumed += n
+		state.args = args
+		if len(args) == 0 {
+			continue
+		}
+
+		state.req.Args = args
+		if err := h.registry.exec(state.req, writer); err != nil {
+			writer.Flush()
+			return consumed, err
+		}
+	}
+	// the replies of the pipelined requests are written together after the callback returns
+	return consumed, writer.Flush()
+}
+
+func (h *Handler) OnClose(conn *coco.EventConn, err error) {
+	logConnError(conn, err)
+}
@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"github.com/246859/codis/coco"
+	"github.com/246859/codis/pkg/logger"
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/redis/resproto2"
+	"github.com/246859/codis/redis/resproto3"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrMaxClients = errors.New("ERR max number of clients reached")
+	// errQuit tell the serving loop to close the connection after replying
+	errQuit = errors.New("redis: client quit")
+)
+
+// Handler is a coco.Handler which speaks redis protocol, it is also a coco.EventHandler for event-loop mode
+type Handler struct {
+	closing  atomic.Bool
+	clients  map[*coco.Client]struct{}
+	mu       sync.Mutex
+	limits   resproto2.Limits
+	registry *Registry
+	keyspace *database.Keyspace
+}
+
+// NewHandler returns a redis handler with the specified protocol limits, command table and keyspace,
+// nil registry means DefaultRegistry, nil keyspace means a keyspace with the default number of databases.
+func NewHandler(limits resproto2.Limits, registry *Registry, keyspace *database.Keyspace) *Handler {
+	if registry == nil {
+		registry = DefaultRegistry()
+	}
+	if keyspace == nil {
+		keyspace = database.NewKeyspace(database.DefaultDatabases)
+	}
+	return &Handler{
+		clients:  make(map[*coco.Client]struct{}),
+		limits:   limits,
+		registry: registry,
+		keyspace: keyspace,
+	}
+}
+
+func (h *Handler) Handle(ctx context.Context, client *coco.Client) {
+	if h.closing.Load() {
+		client.Close()
+		return
+	}
+
+	h.mu.Lock()
+	h.clients[client] = struct{}{}
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, client)
+		h.mu.Unlock()
+		client.Close()
+	}()
+
+	reader := resproto2.NewCommandReaderLimits(client, h.limits)
+	defer reader.Release()
+	// RESP2 until the client switches the protocol by HELLO
+	writer := resproto3.NewRespWriter(client)
+
+	session := &Session{proto: writer.Version()}
+	client.SetValue(session)
+	req := &Request{Client: client, Session: session, Keyspace: h.keyspace}
+	err := resproto2.Serve(reader, writer, func(args [][]byte, writer *resproto3.RespWriter) error {
+		req.Args = args
+		return h.registry.exec(req, writer)
+	})
+	logConnError(client, err)
+}
+
+// logConnError logs the error ends the connection, the errors of closing normally are ignored
+func logConnError(client Client, err error) {
+	if err == nil || errors.Is(err, errQuit) || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return
+	} else if errors.Is(err, os.ErrDeadlineExceeded) {
+		logger.Infof("client %d %s: connection timeout", client.ID(), client.RemoteAddr())
+		return
+	} else if resproto2.IsProtocolError(err) {
+		logger.Warnf("client %d %s: %s", client.ID(), client.RemoteAddr(), err)
+		return
+	}
+	logger.Error("connection error: ", err)
+}
+
+// Close closes all the connections, it can be called multiple times since a handler
+// may serve many listeners. The connections in event-loop mode are closed by the loops.
+func (h *Handler) Close() error {
+	h.closing.Store(true)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var closeErr error
+	for client := range h.clients {
+		closeErr = errors.Join(closeErr, client.Close())
+	}
+	return closeErr
+}
+
+// RejectMaxClients replies the error to the client exceeds max number of clients then closes it,
+// it can be used as coco.Config.RejectHook.
+func RejectMaxClients(conn net.Conn) {
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	writer := resproto2.NewRespWriterSize(conn, 64)
+	writer.WriteError(ErrMaxClients)
+	writer.Flush()
+}
@@ -0,0 +1,217 @@
+package redis
+
+import (
+	"errors"
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/redis/resproto3"
+	"strings"
+)
+
+// keyCommands returns the generic commands operating on keys and databases
+func keyCommands() []*Command {
+	return []*Command{
+		{Name: "del", Arity: -2, Flags: FlagWrite, FirstKey: 1, LastKey: -1, Step: 1, Func: del},
+		{Name: "exists", Arity: -2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Func: exists},
+		{Name: "type", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: typeCommand},
+		{Name: "rename", Arity: 3, Flags: FlagWrite, FirstKey: 1, LastKey: 2, Step: 1, Func: rename},
+		{Name: "renamenx", Arity: 3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 2, Step: 1, Func: renamenx},
+		{Name: "keys", Arity: 2, Flags: FlagReadonly, Func: keys},
+		{Name: "randomkey", Arity: 1, Flags: FlagReadonly, Func: randomKey},
+		{Name: "dbsize", Arity: 1, Flags: FlagReadonly | FlagFast, Func: dbsize},
+		{Name: "flushdb", Arity: -1, Flags: FlagWrite, Func: flushdb},
+		{Name: "flushall", Arity: -1, Flags: FlagWrite, Func: flushall},
+		{Name: "select", Arity: 2, Flags: FlagFast, Func: selectDB},
+		{Name: "swapdb", Arity: 3, Flags: FlagWrite | FlagFast, Func: swapdb},
+		{Name: "move", Arity: 3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: move},
+	}
+}
+
+// DEL key [key ...]
+func del(req *Request, writer *resproto3.RespWriter) error {
+	keys := stringArgs(req.Args[1:])
+
+	db := req.DB()
+	unlock := db.LockKeys(keys, nil)
+	var deleted int64
+	for _, key := range keys {
+		if db.Delete(key) {
+			deleted++
+		}
+	}
+	unlock()
+	return writer.WriteInteger(deleted)
+}
+
+// EXISTS key [key ...], the key mentioned multiple times is counted multiple times
+func exists(req *Request, writer *resproto3.RespWriter) error {
+	keys := stringArgs(req.Args[1:])
+
+	db := req.DB()
+	unlock := db.LockKeys(nil, keys)
+	var count int64
+	for _, key := range keys {
+		if db.Exists(key) {
+			count++
+		}
+	}
+	unlock()
+	return writer.WriteInteger(count)
+}
+
+// TYPE key
+func typeCommand(req *Request, writer *resproto3.RespWriter) error {
+	obj, ok := req.DB().Get(string(req.Args[1]))
+
+	if !ok {
+		return writer.WriteStatus("none")
+	}
+	return writer.WriteStatus(obj.Type.String())
+}
+
+// RENAME key newkey
+func rename(req *Request, writer *resproto3.RespWriter) error {
+	src, dst := string(req.Args[1]), string(req.Args[2])
+
+	db := req.DB()
+	unlock := db.LockKeys([]string{src, dst}, nil)
+	ok := db.Rename(src, dst)
+	unlock()
+
+	if !ok {
+		return writer.WriteError(errNoSuchKey)
+	}
+	return writer.WriteStatus("OK")
+}
+
+// RENAMENX key newkey
+func renamenx(req *Request, writer *resproto3.RespWriter) error {
+	src, dst := string(req.Args[1]), string(req.Args[2])
+
+	db := req.DB()
+	unlock := db.LockKeys([]string{src, dst}, nil)
+	defer unlock()
+
+	if !db.Exists(src) {
+		return writer.WriteError(errNoSuchKey)
+	} else if db.Exists(dst) {
+		return writer.WriteInteger(0)
+	}
+	db.Rename(src, dst)
+	return writer.WriteInteger(1)
+}
+
+// KEYS pattern
+func keys(req *Request, writer *resproto3.RespWriter) error {
+	keys := req.DB().Keys(string(req.Args[1]))
+
+	if err := writer.WriteArrayHeader(len(keys)); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := writer.WriteBulkString(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RANDOMKEY
+func randomKey(req *Request, writer *resproto3.RespWriter) error {
+	key, ok := req.DB().RandomKey()
+
+	if !ok {
+		return writer.WriteNull()
+	}
+	return writer.WriteBulkString(key)
+}
+
+// DBSIZE
+func dbsize(req *Request, writer *resproto3.RespWriter) error {
+	return writer.WriteInteger(int64(req.DB().Len()))
+}
+
+// parseFlushMode checks the optional ASYNC or SYNC argument, the flush is always synchronous
+func parseFlushMode(args [][]byte) bool {
+	if len(args) > 2 {
+		return false
+	} else if len(args) == 2 {
+		mode := strings.ToLower(string(args[1]))
+		return mode == "async" || mode == "sync"
+	}
+	return true
+}
+
+// FLUSHDB [ASYNC | SYNC]
+func flushdb(req *Request, writer *resproto3.RespWriter) error {
+	if !parseFlushMode(req.Args) {
+		return writer.WriteError(errSyntax)
+	}
+
+	req.DB().Flush()
+	return writer.WriteStatus("OK")
+}
+
+// FLUSHALL [ASYNC | SYNC]
+func flushall(req *Request, writer *resproto3.RespWriter) error {
+	if !parseFlushMode(req.Args) {
+		return writer.WriteError(errSyntax)
+	}
+
+	req.Keyspace.FlushAll()
+	return writer.WriteStatus("OK")
+}
+
+// parseDBIndex parses the database index, the errors are replied as redis does
+func parseDBIndex(req *Request, arg []byte, invalid error) (int, error) {
+	index, ok := parseInt(arg)
+	if !ok {
+		return 0, invalid
+	} else if index < 0 || index >= int64(req.Keyspace.Len()) {
+		return 0, database.ErrDBIndexOutOfRange
+	}
+	return int(index), nil
+}
+
+// SELECT index
+func selectDB(req *Request, writer *resproto3.RespWriter) error {
+	index, err := parseDBIndex(req, req.Args[1], errNotInteger)
+	if err != nil {
+		return writer.WriteError(err)
+	}
+	req.Session.db = index
+	return writer.WriteStatus("OK")
+}
+
+// SWAPDB index1 index2
+func swapdb(req *Request, writer *resproto3.RespWriter) error {
+	i, err := parseDBIndex(req, req.Args[1], errors.New("ERR invalid first DB index"))
+	if err != nil {
+		return writer.WriteError(err)
+	}
+	j, err := parseDBIndex(req, req.Args[2], errors.New("ERR invalid second DB index"))
+	if err != nil {
+		return writer.WriteError(err)
+	}
+
+	if err := req.Keyspace.SwapDB(i, j); err != nil {
+		return writer.WriteError(err)
+	}
+	return writer.WriteStatus("OK")
+}
+
+// MOVE key db
+func move(req *Request, writer *resproto3.RespWriter) error {
+	dst, err := parseDBIndex(req, req.Args[2], errNotInteger)
+	if err != nil {
+		return writer.WriteError(err)
+	}
+
+	moved, err := req.Keyspace.Move(string(req.Args[1]), req.Session.db, dst)
+	if err != nil {
+		return writer.WriteError(err)
+	}
+	if moved {
+		return writer.WriteInteger(1)
+	}
+	return writer.WriteInteger(0)
+}
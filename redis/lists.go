@@ -0,0 +1,493 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/redis/datastruct/list"
+	"github.com/246859/codis/redis/resproto3"
+	"math"
+	"strings"
+)
+
+var (
+	errIndexOutOfRange = errors.New("ERR index out of range")
+	errNotPositive     = errors.New("ERR value is out of range, must be positive")
+	errRankZero        = errors.New("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... " +
+		"or use negative to start from the end of the list")
+	errRankOutOfRange = errors.New("ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807")
+	errCountNegative  = errors.New("ERR COUNT can't be negative")
+	errMaxLenNegative = errors.New("ERR MAXLEN can't be negative")
+)
+
+// listCommands returns the commands of list type, the lists are modified in place, so the commands reading them
+// copy the elements under the read locks of keys, and release the locks before the replies are written.
+func listCommands() []*Command {
+	return []*Command{
+		{Name: "lpush", Arity: -3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: push},
+		{Name: "rpush", Arity: -3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: push},
+		{Name: "lpushx", Arity: -3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: push},
+		{Name: "rpushx", Arity: -3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: push},
+		{Name: "lpop", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: pop},
+		{Name: "rpop", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: pop},
+		{Name: "llen", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: llen},
+		{Name: "lrange", Arity: 4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Func: lrange},
+		{Name: "lindex", Arity: 3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Func: lindex},
+		{Name: "lset", Arity: 4, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Func: lset},
+		{Name: "linsert", Arity: 5, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Func: linsert},
+		{Name: "lrem", Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Func: lrem},
+		{Name: "ltrim", Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Func: ltrim},
+		{Name: "lpos", Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Func: lpos},
+		{Name: "lmove", Arity: 5, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Func: lmove},
+		{Name: "rpoplpush", Arity: 3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Func: lmove},
+	}
+}
+
+// lookupList returns the list of key, nil if the key does not exist
+func lookupList(db *database.DB, key string) (*list.QuickList, error) {
+	obj, err := db.Lookup(key, database.TypeList)
+	if obj == nil {
+		return nil, err
+	}
+	return obj.Value.(*list.QuickList), nil
+}
+
+// parseIndex parses the index argument of list commands
+func parseIndex(arg []byte) (int, bool) {
+	n, ok := parseInt(arg)
+	return int(n), ok
+}
+
+// LPUSH key element [element ...], RPUSH, LPUSHX and RPUSHX
+func push(req *Request, writer *resproto3.RespWriter) error {
+	name := req.Command.Name
+	front, onlyExists := name[0] == 'l', name[len(name)-1] == 'x'
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	defer db.Unlock(key)
+
+	l, err := lookupList(db, key)
+	if err != nil {
+		return writer.WriteError(err)
+	} else if l == nil {
+		if onlyExists {
+			return writer.WriteInteger(0)
+		}
+		l = list.New()
+		db.Set(key, database.NewObject(database.TypeList, l))
+	}
+
+	for _, v := range req.Args[2:] {
+		if front {
+			l.PushFront(v)
+		} else {
+			l.PushBack(v)
+		}
+	}
+	return writer.WriteInteger(int64(l.Len()))
+}
+
+// LPOP key [count], RPOP key [count]
+func pop(req *Request, writer *resproto3.RespWriter) error {
+	if len(req.Args) > 3 {
+		return writer.WriteError(wrongArityError(req.Command.Name))
+	}
+
+	count, hasCount := 1, len(req.Args) == 3
+	if hasCount {
+		n, ok := parseInt(req.Args[2])
+		if !ok || n < 0 {
+			return writer.WriteError(errNotPositive)
+		}
+		count = int(n)
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	l, err := lookupList(db, key)
+	var popped [][]byte
+	if l != nil {
+		for len(popped) < count && l.Len() > 0 {
+			var v []byte
+			if req.Command.Name == "lpop" {
+				v, _ = l.PopFront()
+			} else {
+				v, _ = l.PopBack()
+			}
+			popped = append(popped, v)
+		}
+		if l.Len() == 0 {
+			db.Delete(key)
+		}
+	}
+	db.Unlock(key)
+
+	switch {
+	case err != nil:
+		return writer.WriteError(err)
+	case l == nil && hasCount:
+		return writer.WriteNullArray()
+	case l == nil:
+		return writer.WriteNull()
+	case !hasCount:
+		return writer.WriteBulk(popped[0])
+	}
+	return writeBulks(writer, popped)
+}
+
+func writeBulks(writer *resproto3.RespWriter, bulks [][]byte) error {
+	if err := writer.WriteArrayHeader(len(bulks)); err != nil {
+		return err
+	}
+	for _, b := range bulks {
+		if err := writer.WriteBulk(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LLEN key
+func llen(req *Request, writer *resproto3.RespWriter) error {
+	key := string(req.Args[1])
+	db := req.DB()
+	db.RLock(key)
+	l, err := lookupList(db, key)
+	var n int
+	if l != nil {
+		n = l.Len()
+	}
+	db.RUnlock(key)
+
+	if err != nil {
+		return writer.WriteError(err)
+	}
+	return writer.WriteInteger(int64(n))
+}
+
+// LRANGE key start stop, the elements are copied into one buffer under the read lock
+func lrange(req *Request, writer *resproto3.RespWriter) error {
+	start, ok := parseIndex(req.Args[2])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	}
+	stop, ok := parseIndex(req.Args[3])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.RLock(key)
+	l, err := lookupList(db, key)
+
+	var (
+		buf  []byte
+		ends []int
+	)
+	if l != nil {
+		l.Range(start, stop, func(v []byte) bool {
+			buf = append(buf, v...)
+			ends = append(ends, len(buf))
+			return true
+		})
+	}
+	db.RUnlock(key)
+
+	if err != nil {
+		return writer.WriteError(err)
+	}
+
+	elements := make([][]byte, len(ends))
+	for i, end := range ends {
+		begin := 0
+		if i > 0 {
+			begin = ends[i-1]
+		}
+		elements[i] = buf[begin:end]
+	}
+	return writeBulks(writer, elements)
+}
+
+// LINDEX key index
+func lindex(req *Request, writer *resproto3.RespWriter) error {
+	index, ok := parseIndex(req.Args[2])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.RLock(key)
+	l, err := lookupList(db, key)
+
+	var (
+		v     []byte
+		found bool
+	)
+	if l != nil {
+		if v, found = l.Index(index); found {
+			v = bytes.Clone(v)
+		}
+	}
+	db.RUnlock(key)
+
+	if err != nil {
+		return writer.WriteError(err)
+	} else if !found {
+		return writer.WriteNull()
+	}
+	return writer.WriteBulk(v)
+}
+
+// LSET key index element
+func lset(req *Request, writer *resproto3.RespWriter) error {
+	index, ok := parseIndex(req.Args[2])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	defer db.Unlock(key)
+
+	l, err := lookupList(db, key)
+	if err != nil {
+		return writer.WriteError(err)
+	} else if l == nil {
+		return writer.WriteError(errNoSuchKey)
+	} else if !l.Set(index, req.Args[3]) {
+		return writer.WriteError(errIndexOutOfRange)
+	}
+	return writer.WriteStatus("OK")
+}
+
+// LINSERT key BEFORE | AFTER pivot element
+func linsert(req *Request, writer *resproto3.RespWriter) error {
+	var before bool
+	switch where := strings.ToLower(string(req.Args[2])); where {
+	case "before":
+		before = true
+	case "after":
+	default:
+		return writer.WriteError(errSyntax)
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	defer db.Unlock(key)
+
+	l, err := lookupList(db, key)
+	if err != nil {
+		return writer.WriteError(err)
+	} else if l == nil {
+		return writer.WriteInteger(0)
+	} else if !l.Insert(req.Args[3], req.Args[4], before) {
+		return writer.WriteInteger(-1)
+	}
+	return writer.WriteInteger(int64(l.Len()))
+}
+
+// LREM key count element
+func lrem(req *Request, writer *resproto3.RespWriter) error {
+	count, ok := parseIndex(req.Args[2])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	defer db.Unlock(key)
+
+	l, err := lookupList(db, key)
+	if err != nil {
+		return writer.WriteError(err)
+	} else if l == nil {
+		return writer.WriteInteger(0)
+	}
+
+	removed := l.Remove(req.Args[3], count)
+	if l.Len() == 0 {
+		db.Delete(key)
+	}
+	return writer.WriteInteger(int64(removed))
+}
+
+// LTRIM key start stop
+func ltrim(req *Request, writer *resproto3.RespWriter) error {
+	start, ok := parseIndex(req.Args[2])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	}
+	stop, ok := parseIndex(req.Args[3])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	defer db.Unlock(key)
+
+	l, err := lookupList(db, key)
+	if err != nil {
+		return writer.WriteError(err)
+	} else if l != nil {
+		l.Trim(start, stop)
+		if l.Len() == 0 {
+			db.Delete(key)
+		}
+	}
+	return writer.WriteStatus("OK")
+}
+
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func lpos(req *Request, writer *resproto3.RespWriter) error {
+	// count -1 means the option is absent, the first match is replied as an integer
+	rank, count, maxLen := int64(1), int64(-1), int64(0)
+	for i := 3; i < len(req.Args); i++ {
+		option := strings.ToLower(string(req.Args[i]))
+		if i+1 >= len(req.Args) || option != "rank" && option != "count" && option != "maxlen" {
+			return writer.WriteError(errSyntax)
+		}
+
+		i++
+		n, ok := parseInt(req.Args[i])
+		switch option {
+		case "rank":
+			if !ok {
+				return writer.WriteError(errNotInteger)
+			} else if n == 0 {
+				return writer.WriteError(errRankZero)
+			} else if n == math.MinInt64 {
+				// the rank is negated to count from the tail
+				return writer.WriteError(errRankOutOfRange)
+			}
+			rank = n
+		case "count":
+			if !ok || n < 0 {
+				return writer.WriteError(errCountNegative)
+			}
+			count = n
+		case "maxlen":
+			if !ok || n < 0 {
+				return writer.WriteError(errMaxLenNegative)
+			}
+			maxLen = n
+		}
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.RLock(key)
+	l, err := lookupList(db, key)
+
+	var matches []int64
+	if l != nil {
+		reverse, skip := rank < 0, max(rank, -rank)-1
+		index, step, start := int64(0), int64(1), 0
+		if reverse {
+			index, step, start = int64(l.Len()-1), -1, -1
+		}
+
+		it := l.IteratorAt(start, reverse)
+		for compared := int64(0); it.Next() && (maxLen == 0 || compared < maxLen); compared++ {
+			if bytes.Equal(it.Value(), req.Args[2]) {
+				if skip > 0 {
+					skip--
+				} else if matches = append(matches, index); count != 0 && int64(len(matches)) >= max(count, 1) {
+					break
+				}
+			}
+			index += step
+		}
+	}
+	db.RUnlock(key)
+
+	if err != nil {
+		return writer.WriteError(err)
+	} else if count == -1 {
+		if len(matches) == 0 {
+			return writer.WriteNull()
+		}
+		return writer.WriteInteger(matches[0])
+	}
+
+	if err := writer.WriteArrayHeader(len(matches)); err != nil {
+		return err
+	}
+	for _, m := range matches {
+		if err := writer.WriteInteger(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LMOVE source destination LEFT | RIGHT LEFT | RIGHT, RPOPLPUSH source destination
+func lmove(req *Request, writer *resproto3.RespWriter) error {
+	fromLeft, toLeft := false, true
+	if req.Command.Name == "lmove" {
+		var ok bool
+		if fromLeft, ok = parseListSide(req.Args[3]); !ok {
+			return writer.WriteError(errSyntax)
+		}
+		if toLeft, ok = parseListSide(req.Args[4]); !ok {
+			return writer.WriteError(errSyntax)
+		}
+	}
+
+	srcKey, dstKey := string(req.Args[1]), string(req.Args[2])
+	db := req.DB()
+	unlock := db.LockKeys([]string{srcKey, dstKey}, nil)
+	defer unlock()
+
+	src, err := lookupList(db, srcKey)
+	if err != nil {
+		return writer.WriteError(err)
+	} else if src == nil {
+		return writer.WriteNull()
+	}
+	dst, err := lookupList(db, dstKey)
+	if err != nil {
+		return writer.WriteError(err)
+	}
+
+	var v []byte
+	if fromLeft {
+		v, _ = src.PopFront()
+	} else {
+		v, _ = src.PopBack()
+	}
+	if src.Len() == 0 && srcKey != dstKey {
+		db.Delete(srcKey)
+	}
+
+	if dst == nil {
+		dst = list.New()
+		db.Set(dstKey, database.NewObject(database.TypeList, dst))
+	}
+	if toLeft {
+		dst.PushFront(v)
+	} else {
+		dst.PushBack(v)
+	}
+	return writer.WriteBulk(v)
+}
+
+// parseListSide parses LEFT or RIGHT, returns true for LEFT
+func parseListSide(arg []byte) (left bool, ok bool) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, true
+	case "right":
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,339 @@
+package resproto2
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	defaultReaderSize = 16 * 1024
+	// argument buffer larger than it will not be reused, avoid holding huge memory after a big request
+	maxRetainedBufSize = 1024 * 1024
+)
+
+var argBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 4096)
+		return &buf
+	},
+}
+
+// CommandReader reads requests from client into a reusable argument vector,
+// it is a specialized and allocation-free version of ParseRespProto for the server side.
+type CommandReader struct {
+	r      *bufio.Reader
+	limits Limits
+	// backing storage of arguments, reused between commands
+	buf *[]byte
+	// offsets of arguments in buf
+	offsets []int
+}
+
+// NewCommandReader returns a CommandReader with DefaultLimits
+func NewCommandReader(reader io.Reader) *CommandReader {
+	return NewCommandReaderLimits(reader, DefaultLimits)
+}
+
+// NewCommandReaderLimits returns a CommandReader with the specified limits
+func NewCommandReaderLimits(reader io.Reader, limits Limits) *CommandReader {
+	return &CommandReader{
+		r:      bufio.NewReaderSize(reader, defaultReaderSize),
+		limits: limits.WithDefaults(),
+		buf:    argBufPool.Get().(*[]byte),
+	}
+}
+
+// ReadCommand read a multibulk or inline request, the arguments are appended to args[:0] and returned.
+// The returned arguments are only valid until the next call of ReadCommand, copy them if needed.
+// Empty requests are skipped, so a successful call always returns at least one argument.
+func (c *CommandReader) ReadCommand(args [][]byte) ([][]byte, error) {
+	if c.buf == nil {
+		c.buf = argBufPool.Get().(*[]byte)
+	} else if cap(*c.buf) > maxRetainedBufSize {
+		c.buf = argBufPool.Get().(*[]byte)
+	}
+
+	args = args[:0]
+	*c.buf = (*c.buf)[:0]
+	c.offsets = c.offsets[:0]
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return args, err
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] != arrayMsg {
+			if !isInlineHeader(line[0]) {
+				return args, &ProtocolError{Reason: fmt.Sprintf("expected '%c', got '%c'", arrayMsg, line[0])}
+			}
+			inlineArgs, err := SplitArgs(line)
+			if err != nil {
+				return args, err
+			} else if len(inlineArgs) == 0 {
+				continue
+			}
+			return append(args, inlineArgs...), nil
+		}
+
+		count, ok := parseDecimal(line[1:])
+		if !ok || count > c.limits.MaxMultiBulkLen {
+			return args, ErrInvalidMultiBulkLength
+		} else if count <= 0 {
+			continue
+		}
+
+		for i := int64(0); i < count; i++ {
+			if err := c.readBulk(); err != nil {
+				return args, err
+			}
+		}
+
+		// slice arguments after all bulks have been read, since buf may grow during reading
+		buf := *c.buf
+		for i := 0; i+1 < len(c.offsets); i += 2 {
+			args = append(args, buf[c.offsets[i]:c.offsets[i+1]:c.offsets[i+1]])
+		}
+		return args, nil
+	}
+}
+
+// readBulk read a bulk string and append it to buf
+func (c *CommandReader) readBulk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+
+	if len(line) == 0 || line[0] != bulkStringMsg {
+		got := byte(' ')
+		if len(line) > 0 {
+			got = line[0]
+		}
+		return &ProtocolError{Reason: fmt.Sprintf("expected '%c', got '%c'", bulkStringMsg, got)}
+	}
+
+	n, ok := parseDecimal(line[1:])
+	if !ok || n < 0 || n > c.limits.MaxBulkLen {
+		return ErrInvalidBulkLength
+	}
+
+	buf := *c.buf
+	start := len(buf)
+	end := start + int(n)
+	if end+len(CRLF) > cap(buf) {
+		grown := make([]byte, len(buf), 2*cap(buf)+int(n)+len(CRLF))
+		copy(grown, buf)
+		buf = grown
+	}
+	buf = buf[:end+len(CRLF)]
+
+	if _, err := io.ReadFull(c.r, buf[start:]); err != nil {
+		return err
+	}
+
+	// drop the trailing CRLF
+	*c.buf = buf[:end]
+	c.offsets = append(c.offsets, start, end)
+	return nil
+}
+
+// readLine read a line without CRLF, the returned slice is only valid until the next read
+func (c *CommandReader) readLine() ([]byte, error) {
+	line, err := c.r.ReadSlice(LF)
+	if errors.Is(err, bufio.ErrBufferFull) {
+		// the line is longer than the buffer, fallback to the slow path,
+		// copy it first because the following read will overwrite the buffer.
+		head := append([]byte(nil), line...)
+		rest, err := ReadLine(c.r, c.limits.MaxInlineLen-len(head))
+		if err != nil {
+			return nil, err
+		}
+		return append(head, rest...), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(line) > c.limits.MaxInlineLen+len(CRLF) {
+		return nil, ErrTooBigInlineRequest
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == CR {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// Buffered returns the number of bytes that have been read from the connection but not consumed yet,
+// a positive value means there are more pipelined requests to be processed.
+func (c *CommandReader) Buffered() int {
+	return c.r.Buffered()
+}
+
+// Reset discards any buffered data and switch to read from reader
+func (c *CommandReader) Reset(reader io.Reader) {
+	c.r.Reset(reader)
+}
+
+// Release puts the argument buffer back to the pool, arguments returned before are invalid after releasing.
+func (c *CommandReader) Release() {
+	if c.buf == nil {
+		return
+	}
+	if cap(*c.buf) <= maxRetainedBufSize {
+		*c.buf = (*c.buf)[:0]
+		argBufPool.Put(c.buf)
+	}
+	c.buf = nil
+}
+
+// CommandParser parses requests from the received bytes, it is the counterpart of CommandReader for the
+// connections which are not read by blocking calls, e.g. in event-loop mode. A partial multibulk request is
+// resumed from where it stopped when more bytes arrive, instead of being parsed again from the start.
+type CommandParser struct {
+	limits Limits
+
+	// state of the partial multibulk request: the number of arguments, the parsed bytes
+	// and the offsets of the parsed arguments
+	count   int64
+	pos     int
+	offsets []int
+}
+
+// NewCommandParser returns a CommandParser with the specified limits
+func NewCommandParser(limits Limits) *CommandParser {
+	return &CommandParser{limits: limits.WithDefaults()}
+}
+
+// Parse parses the first request in data, the arguments are appended to args[:0] and returned, they refer to data
+// directly. It returns the number of bytes consumed, 0 means the request is incomplete, then data passed to the
+// next call must begin with the same unconsumed bytes. An empty request is consumed without arguments.
+func (p *CommandParser) Parse(data []byte, args [][]byte) ([][]byte, int, error) {
+	args = args[:0]
+
+	if p.count == 0 {
+		line, n, err := scanLine(data, p.limits.MaxInlineLen)
+		if err != nil || n == 0 {
+			return args, 0, err
+		} else if len(line) == 0 {
+			return args, n, nil
+		}
+
+		if line[0] != arrayMsg {
+			if !isInlineHeader(line[0]) {
+				return args, 0, &ProtocolError{Reason: fmt.Sprintf("expected '%c', got '%c'", arrayMsg, line[0])}
+			}
+			inlineArgs, err := SplitArgs(line)
+			if err != nil {
+				return args, 0, err
+			}
+			return append(args, inlineArgs...), n, nil
+		}
+
+		count, ok := parseDecimal(line[1:])
+		if !ok || count > p.limits.MaxMultiBulkLen {
+			return args, 0, ErrInvalidMultiBulkLength
+		} else if count <= 0 {
+			return args, n, nil
+		}
+		p.count, p.pos, p.offsets = count, n, p.offsets[:0]
+	}
+
+	for int64(len(p.offsets)/2) < p.count {
+		line, n, err := scanLine(data[p.pos:], p.limits.MaxInlineLen)
+		if err != nil {
+			p.count = 0
+			return args, 0, err
+		} else if n == 0 {
+			return args, 0, nil
+		}
+
+		if len(line) == 0 || line[0] != bulkStringMsg {
+			got := byte(' ')
+			if len(line) > 0 {
+				got = line[0]
+			}
+			p.count = 0
+			return args, 0, &ProtocolError{Reason: fmt.Sprintf("expected '%c', got '%c'", bulkStringMsg, got)}
+		}
+
+		size, ok := parseDecimal(line[1:])
+		if !ok || size < 0 || size > p.limits.MaxBulkLen {
+			p.count = 0
+			return args, 0, ErrInvalidBulkLength
+		}
+
+		start := p.pos + n
+		end := start + int(size)
+		if len(data) < end+len(CRLF) {
+			return args, 0, nil
+		}
+		p.offsets = append(p.offsets, start, end)
+		p.pos = end + len(CRLF)
+	}
+
+	for i := 0; i+1 < len(p.offsets); i += 2 {
+		args = append(args, data[p.offsets[i]:p.offsets[i+1]:p.offsets[i+1]])
+	}
+	consumed := p.pos
+	p.count, p.pos = 0, 0
+	if cap(p.offsets) > maxRetainedBufSize {
+		p.offsets = nil
+	}
+	return args, consumed, nil
+}
+
+// scanLine returns the first line in data without CRLF and the length including CRLF, 0 means the line is incomplete
+func scanLine(data []byte, max int) ([]byte, int, error) {
+	i := bytes.IndexByte(data, LF)
+	if i < 0 {
+		if len(data) > max+len(CRLF) {
+			return nil, 0, ErrTooBigInlineRequest
+		}
+		return nil, 0, nil
+	} else if i+1 > max+len(CRLF) {
+		return nil, 0, ErrTooBigInlineRequest
+	}
+
+	line := data[:i]
+	if len(line) > 0 && line[len(line)-1] == CR {
+		line = line[:len(line)-1]
+	}
+	return line, i + 1, nil
+}
+
+// parseDecimal parse a decimal integer without allocation
+func parseDecimal(b []byte) (int64, bool) {
+	neg := false
+	if len(b) > 0 && b[0] == '-' {
+		neg = true
+		b = b[1:]
+	}
+
+	// at most 18 digits to avoid overflow
+	if len(b) == 0 || len(b) > 18 {
+		return 0, false
+	}
+
+	var n int64
+	for _, ch := range b {
+		if ch < '0' || ch > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(ch-'0')
+	}
+
+	if neg {
+		n = -n
+	}
+	return n, true
+}
@@ -64,7 +64,6 @@ func (a ArrayMsg) Bytes() []byte {
 	for _, data := range a.arr {
 		b = append(b, data.Bytes()...)
 	}
-	b = append(b, CRLF...)
 	return b
 }
 
@@ -77,10 +76,23 @@ func (b BulkStringMsg) Len() int64 {
 	return b.len
 }
 
+// Data returns the raw payload of bulk string without the header and trailing CRLF
+func (b BulkStringMsg) Data() []byte {
+	return b.data
+}
+
+// IsNull reports whether the bulk string is a null bulk string, like $-1\r\n
+func (b BulkStringMsg) IsNull() bool {
+	return b.len < 0
+}
+
 func (b BulkStringMsg) Bytes() []byte {
 	var bs []byte
 	bs = append(bs, fmt.Sprintf("%c%d\r\n", bulkStringMsg, b.len)...)
+	if b.len < 0 {
+		return bs
+	}
 	bs = append(bs, b.data...)
 	bs = append(bs, CRLF...)
-	return b.data
+	return bs
 }
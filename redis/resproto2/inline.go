@@ -0,0 +1,140 @@
+package resproto2
+
+import (
+	"strconv"
+)
+
+// isInlineHeader reports whether the first byte of line can start an inline command,
+// like PING or SET "my key" 'my value' typed in telnet.
+func isInlineHeader(b byte) bool {
+	return b >= 'a' && b <= 'z' ||
+		b >= 'A' && b <= 'Z' ||
+		b >= '0' && b <= '9' ||
+		b == ' ' || b == '\t' ||
+		b == '"' || b == '\''
+}
+
+// parseInline parse an inline command into an array of bulk strings
+func parseInline(line []byte) (ArrayMsg, error) {
+	args, err := SplitArgs(line)
+	if err != nil {
+		return ArrayMsg{}, err
+	}
+
+	arr := make([]Data, 0, len(args))
+	for _, arg := range args {
+		arr = append(arr, BulkStringMsg{data: arg, len: int64(len(arg))})
+	}
+
+	return ArrayMsg{arr: arr, len: int64(len(arr))}, EOF
+}
+
+// SplitArgs split the line into arguments with the same quoting rules as redis-cli, inline commands and redis.conf.
+// Arguments are separated by spaces, in double quotes the escapes \n \r \t \b \a \\ \" and \xHH are supported,
+// in single quotes only \' is supported, and a closing quote must be followed by a space or the end of line.
+func SplitArgs(line []byte) ([][]byte, error) {
+	var (
+		args [][]byte
+		i    int
+	)
+
+	for {
+		// skip blanks
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+
+		if i >= len(line) {
+			return args, nil
+		}
+
+		var (
+			current []byte
+			inDq    bool
+			inSq    bool
+			done    bool
+		)
+
+		for !done {
+			if inDq {
+				if i >= len(line) {
+					return nil, ErrUnbalancedQuotes
+				}
+				if line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]) {
+					b, _ := strconv.ParseUint(string(line[i+2:i+4]), 16, 8)
+					current = append(current, byte(b))
+					i += 3
+				} else if line[i] == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if line[i] == '"' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, ErrUnbalancedQuotes
+					}
+					done = true
+				} else {
+					current = append(current, line[i])
+				}
+			} else if inSq {
+				if i >= len(line) {
+					return nil, ErrUnbalancedQuotes
+				}
+				if line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					current = append(current, '\'')
+				} else if line[i] == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, ErrUnbalancedQuotes
+					}
+					done = true
+				} else {
+					current = append(current, line[i])
+				}
+			} else {
+				if i >= len(line) {
+					break
+				}
+				switch line[i] {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inDq = true
+				case '\'':
+					inSq = true
+				default:
+					current = append(current, line[i])
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+
+		if current == nil {
+			current = make([]byte, 0)
+		}
+		args = append(args, current)
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+func isHex(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'f' || b >= 'A' && b <= 'F'
+}
@@ -0,0 +1,96 @@
+package resproto2
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Limits restrict the size of untrusted input, a zero field means using the default value
+type Limits struct {
+	// max length of a bulk string, same as proto-max-bulk-len in redis
+	MaxBulkLen int64 `yaml:"maxBulkLen"`
+	// max number of elements in an array
+	MaxMultiBulkLen int64 `yaml:"maxMultiBulkLen"`
+	// max nesting depth of arrays
+	MaxDepth int `yaml:"maxDepth"`
+	// max length of a single line, includes inline commands and headers
+	MaxInlineLen int `yaml:"maxInlineLen"`
+}
+
+// DefaultLimits is same as the default limits of redis
+var DefaultLimits = Limits{
+	MaxBulkLen:      512 * 1024 * 1024,
+	MaxMultiBulkLen: 1024 * 1024,
+	MaxDepth:        32,
+	MaxInlineLen:    64 * 1024,
+}
+
+// WithDefaults returns the limits whose zero fields are replaced by the default values
+func (l Limits) WithDefaults() Limits {
+	if l.MaxBulkLen <= 0 {
+		l.MaxBulkLen = DefaultLimits.MaxBulkLen
+	}
+	if l.MaxMultiBulkLen <= 0 {
+		l.MaxMultiBulkLen = DefaultLimits.MaxMultiBulkLen
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = DefaultLimits.MaxDepth
+	}
+	if l.MaxInlineLen <= 0 {
+		l.MaxInlineLen = DefaultLimits.MaxInlineLen
+	}
+	return l
+}
+
+// ProtocolError means the input violates the protocol or the limits,
+// the connection should be closed after replying it, because the rest of input can not be trusted.
+type ProtocolError struct {
+	Reason string
+}
+
+func (p *ProtocolError) Error() string {
+	return "Protocol error: " + p.Reason
+}
+
+var (
+	ErrInvalidBulkLength      = &ProtocolError{Reason: "invalid bulk length"}
+	ErrInvalidMultiBulkLength = &ProtocolError{Reason: "invalid multibulk length"}
+	ErrTooDeepNesting         = &ProtocolError{Reason: "too deep nesting"}
+	ErrTooBigInlineRequest    = &ProtocolError{Reason: "too big inline request"}
+)
+
+// IsProtocolError reports whether err is caused by a malformed or oversize input
+func IsProtocolError(err error) bool {
+	var perr *ProtocolError
+	return errors.As(err, &perr)
+}
+
+// ReadLine read a line without the trailing CRLF, returns ErrTooBigInlineRequest if it exceeds max bytes,
+// it bounds the lines of both RESP2 and RESP3 parsers.
+func ReadLine(reader *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	for {
+		frag, err := reader.ReadSlice(LF)
+		if len(line)+len(frag) > max+len(CRLF) {
+			return nil, ErrTooBigInlineRequest
+		}
+		line = append(line, frag...)
+
+		if err == nil {
+			break
+		} else if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		} else if errors.Is(err, io.EOF) && len(line) > 0 {
+			// the last line without CRLF
+			return line, nil
+		}
+		return nil, err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == CR {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
@@ -26,6 +26,8 @@ var (
 	ErrInvalidReader      = errors.New("invalid reader")
 	ErrInvalidHeader      = errors.New("invalid header")
 	ErrMismatchHeaderType = errors.New("mismatch header type")
+	ErrUnknownHeaderType  = &ProtocolError{Reason: "unknown header type"}
+	ErrUnbalancedQuotes   = &ProtocolError{Reason: "unbalanced quotes in request"}
 	// EOF represent an individual message parse completed
 	EOF = errors.New("RESP EOF")
 )
@@ -34,21 +36,39 @@ type RespIterator func() (Data, error)
 
 type RespProtocolParser func(firstLine []byte, reader textproto.Reader) (Data, error)
 
-// ParseRespProto RESP Protocol parser
+// ParseRespProto RESP Protocol parser with DefaultLimits
 func ParseRespProto(reader io.Reader) RespIterator {
+	return ParseRespProtoLimits(reader, DefaultLimits)
+}
+
+// ParseRespProtoLimits RESP Protocol parser with the specified limits,
+// it returns a *ProtocolError once the input exceeds the limits.
+func ParseRespProtoLimits(reader io.Reader, limits Limits) RespIterator {
 	respReader := textproto.NewReader(bufio.NewReaderSize(reader, 10240))
-	return parse(respReader)
+	return parse(respReader, limits.WithDefaults(), 0)
 }
 
-func parse(reader *textproto.Reader) RespIterator {
+func parse(reader *textproto.Reader, limits Limits, depth int) RespIterator {
 
 	return func() (Data, error) {
-		// it will clear the CRLF default
-		header, err := reader.ReadLineBytes()
+		// it will clear the CRLF
+		header, err := ReadLine(reader.R, limits.MaxInlineLen)
 		if err != nil {
 			return nil, err
 		}
 
+		// skip the empty lines between commands, like what redis does for inline commands
+		for len(header) == 0 && depth == 0 {
+			header, err = ReadLine(reader.R, limits.MaxInlineLen)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(header) == 0 {
+			return nil, errors2.Wrap(ErrUnknownHeaderType, "empty line")
+		}
+
 		var (
 			data     Data
 			parseErr error
@@ -58,13 +78,20 @@ func parse(reader *textproto.Reader) RespIterator {
 		case simpleStringMsg:
 			data, parseErr = parseSimpleString(header, reader)
 		case bulkStringMsg:
-			data, parseErr = parseBulkString(header, reader)
+			data, parseErr = parseBulkString(header, reader, limits)
 		case integerMsg:
 			data, parseErr = parseInteger(header, reader)
 		case arrayMsg:
-			data, parseErr = parseArray(header, reader)
+			data, parseErr = parseArray(header, reader, limits, depth)
 		case errorMsg:
 			data, parseErr = parseError(header, reader)
+		default:
+			// inline commands are only allowed at the top level, the elements of array must be typed
+			if depth == 0 && isInlineHeader(header[0]) {
+				data, parseErr = parseInline(header)
+			} else {
+				parseErr = errors2.Wrap(ErrUnknownHeaderType, strconv.Quote(string(header[0])))
+			}
 		}
 
 		return data, parseErr
@@ -118,7 +145,7 @@ func parseInteger(header []byte, reader *textproto.Reader) (IntegerMsg, error) {
 	return IntegerMsg{i: i}, EOF
 }
 
-func parseBulkString(header []byte, reader *textproto.Reader) (BulkStringMsg, error) {
+func parseBulkString(header []byte, reader *textproto.Reader, limits Limits) (BulkStringMsg, error) {
 
 	if header == nil {
 		return BulkStringMsg{}, ErrInvalidHeader
@@ -131,8 +158,8 @@ func parseBulkString(header []byte, reader *textproto.Reader) (BulkStringMsg, er
 	// parse bulk string content length
 	contentLengthData := string(header[1:])
 	contentLen, err := strconv.ParseInt(contentLengthData, 10, 64)
-	if err != nil {
-		return BulkStringMsg{}, err
+	if err != nil || contentLen < -1 || contentLen > limits.MaxBulkLen {
+		return BulkStringMsg{}, ErrInvalidBulkLength
 	}
 
 	if contentLen < 0 {
@@ -162,7 +189,7 @@ func parseBulkString(header []byte, reader *textproto.Reader) (BulkStringMsg, er
 	}, EOF
 }
 
-func parseArray(header []byte, reader *textproto.Reader) (ArrayMsg, error) {
+func parseArray(header []byte, reader *textproto.Reader, limits Limits, depth int) (ArrayMsg, error) {
 	if header == nil {
 		return ArrayMsg{}, ErrInvalidHeader
 	} else if header[0] != arrayMsg {
@@ -172,8 +199,12 @@ func parseArray(header []byte, reader *textproto.Reader) (ArrayMsg, error) {
 	// parse arr content length
 	contentLengthData := string(header[1:])
 	contentLen, err := strconv.ParseInt(contentLengthData, 10, 64)
-	if err != nil {
-		return ArrayMsg{}, err
+	if err != nil || contentLen < -1 || contentLen > limits.MaxMultiBulkLen {
+		return ArrayMsg{}, ErrInvalidMultiBulkLength
+	}
+
+	if depth >= limits.MaxDepth {
+		return ArrayMsg{}, ErrTooDeepNesting
 	}
 
 	var dataList []Data
@@ -185,7 +216,7 @@ func parseArray(header []byte, reader *textproto.Reader) (ArrayMsg, error) {
 		}, EOF
 	}
 
-	next := parse(reader)
+	next := parse(reader, limits, depth+1)
 
 	for i := int64(0); i < contentLen; i++ {
 		data, err := next()
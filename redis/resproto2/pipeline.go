@@ -0,0 +1,49 @@
+package resproto2
+
+import (
+	"errors"
+)
+
+// ReplyWriter is the buffered writer of replies used by Serve, e.g. *RespWriter, or the versioned
+// writer in resproto3 for the connections which may switch to RESP3.
+type ReplyWriter interface {
+	WriteError(err error) error
+	Flush() error
+}
+
+// CommandFunc executes a command and writes the reply into writer without flushing,
+// the args are only valid during the call. Returning an error will stop serving.
+type CommandFunc[W ReplyWriter] func(args [][]byte, writer W) error
+
+// Serve runs the read-execute-reply loop until reader or fn returns an error.
+// Replies are flushed only when the reader has no more buffered requests, so a pipeline
+// of many commands sent in one round-trip results in a handful of write syscalls rather than one per reply.
+// If the client violates the protocol, the error is replied before returning it.
+func Serve[W ReplyWriter](reader *CommandReader, writer W, fn CommandFunc[W]) error {
+	args := make([][]byte, 0, 8)
+
+	for {
+		var err error
+		args, err = reader.ReadCommand(args)
+		if err != nil {
+			if IsProtocolError(err) {
+				writer.WriteError(errors.New("ERR " + err.Error()))
+			}
+			// flush the replies of previous commands as much as possible
+			writer.Flush()
+			return err
+		}
+
+		if err := fn(args, writer); err != nil {
+			writer.Flush()
+			return err
+		}
+
+		// the pipeline is drained, send the replies
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/246859/codis/redis/resproto2"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCommandReader(t *testing.T) {
+	input := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n" +
+		"*0\r\n" +
+		"\r\n" +
+		"GET key\r\n" +
+		"*2\r\n$3\r\nGET\r\n$0\r\n\r\n" +
+		"*1\r\n$20000\r\n" + strings.Repeat("a", 20000) + "\r\n"
+
+	expected := [][]string{
+		{"SET", "key", "value"},
+		{"GET", "key"},
+		{"GET", ""},
+		{strings.Repeat("a", 20000)},
+	}
+
+	reader := resproto2.NewCommandReader(strings.NewReader(input))
+	defer reader.Release()
+
+	var args [][]byte
+	for _, exp := range expected {
+		var err error
+		args, err = reader.ReadCommand(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(args) != len(exp) {
+			t.Fatalf("expected %d args, got %d", len(exp), len(args))
+		}
+		for i := range args {
+			if string(args[i]) != exp[i] {
+				t.Errorf("expected %q, got %q", exp[i], args[i])
+			}
+		}
+	}
+
+	if _, err := reader.ReadCommand(args); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestCommandReaderError(t *testing.T) {
+	cases := []struct {
+		input string
+		err   error
+	}{
+		{"*1\r\n$9999999999\r\n", resproto2.ErrInvalidBulkLength},
+		{"*2147483647\r\n", resproto2.ErrInvalidMultiBulkLength},
+		{"*a\r\n", resproto2.ErrInvalidMultiBulkLength},
+		{"SET \"a\r\n", resproto2.ErrUnbalancedQuotes},
+		{strings.Repeat("a", 70*1024) + "\r\n", resproto2.ErrTooBigInlineRequest},
+	}
+
+	for _, c := range cases {
+		_, err := resproto2.NewCommandReader(strings.NewReader(c.input)).ReadCommand(nil)
+		if !errors.Is(err, c.err) {
+			t.Errorf("expected %v, got %v", c.err, err)
+		}
+	}
+
+	_, err := resproto2.NewCommandReader(strings.NewReader("*1\r\n:1\r\n")).ReadCommand(nil)
+	if !resproto2.IsProtocolError(err) {
+		t.Errorf("expected protocol error, got %v", err)
+	}
+}
+
+func TestCommandParser(t *testing.T) {
+	input := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n" +
+		"*0\r\n" +
+		"\r\n" +
+		"GET key\r\n" +
+		"*2\r\n$3\r\nGET\r\n$0\r\n\r\n" +
+		"*1\r\n$20000\r\n" + strings.Repeat("a", 20000) + "\r\n"
+
+	expected := [][]string{
+		{"SET", "key", "value"},
+		{},
+		{},
+		{"GET", "key"},
+		{"GET", ""},
+		{strings.Repeat("a", 20000)},
+	}
+
+	// the input arrives in small pieces, the unconsumed bytes are passed again with the following ones
+	parser := resproto2.NewCommandParser(resproto2.DefaultLimits)
+	var (
+		buf, data []byte
+		got       [][]string
+		args      [][]byte
+	)
+	for len(data) < len(input) {
+		data = []byte(input[:min(len(data)+7, len(input))])
+		for {
+			var (
+				n   int
+				err error
+			)
+			args, n, err = parser.Parse(data[len(buf):], args)
+			if err != nil {
+				t.Fatal(err)
+			} else if n == 0 {
+				break
+			}
+			strs := []string{}
+			for _, arg := range args {
+				strs = append(strs, string(arg))
+			}
+			got = append(got, strs)
+			buf = data[:len(buf)+n]
+		}
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d commands, got %d", len(expected), len(got))
+	}
+	for i, exp := range expected {
+		if strings.Join(got[i], " ") != strings.Join(exp, " ") || len(got[i]) != len(exp) {
+			t.Errorf("expected %q, got %q", exp, got[i])
+		}
+	}
+
+	cases := []struct {
+		input string
+		err   error
+	}{
+		{"*1\r\n$9999999999\r\n", resproto2.ErrInvalidBulkLength},
+		{"*2147483647\r\n", resproto2.ErrInvalidMultiBulkLength},
+		{"*a\r\n", resproto2.ErrInvalidMultiBulkLength},
+		{"SET \"a\r\n", resproto2.ErrUnbalancedQuotes},
+		{strings.Repeat("a", 70*1024), resproto2.ErrTooBigInlineRequest},
+	}
+
+	for _, c := range cases {
+		_, _, err := resproto2.NewCommandParser(resproto2.DefaultLimits).Parse([]byte(c.input), nil)
+		if !errors.Is(err, c.err) {
+			t.Errorf("expected %v, got %v", c.err, err)
+		}
+	}
+
+	_, _, err := resproto2.NewCommandParser(resproto2.DefaultLimits).Parse([]byte("*1\r\n:1\r\n"), nil)
+	if !resproto2.IsProtocolError(err) {
+		t.Errorf("expected protocol error, got %v", err)
+	}
+}
+
+// repeatReader repeats the data endlessly
+type repeatReader struct {
+	data []byte
+	off  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.data[r.off:])
+		n += c
+		r.off = (r.off + c) % len(r.data)
+	}
+	return n, nil
+}
+
+var benchCommand = []byte("*3\r\n$3\r\nSET\r\n$16\r\nkey:000000000001\r\n$32\r\n" + strings.Repeat("v", 32) + "\r\n")
+
+func BenchmarkReadCommand(b *testing.B) {
+	reader := resproto2.NewCommandReader(&repeatReader{data: benchCommand})
+	defer reader.Release()
+	args := make([][]byte, 0, 8)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchCommand)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var err error
+		args, err = reader.ReadCommand(args)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseRespProto(b *testing.B) {
+	next := resproto2.ParseRespProto(&repeatReader{data: benchCommand})
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchCommand)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := next(); err != nil && !errors.Is(err, resproto2.EOF) {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadCommandPipeline(b *testing.B) {
+	pipeline := bytes.Repeat(benchCommand, 100)
+	reader := resproto2.NewCommandReader(&repeatReader{data: pipeline})
+	defer reader.Release()
+	args := make([][]byte, 0, 8)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchCommand)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var err error
+		args, err = reader.ReadCommand(args)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/246859/codis/redis/resproto2"
+	"testing"
+)
+
+func inlineArgs(t *testing.T, line string) ([]string, error) {
+	data, err := resproto2.ParseRespProto(bytes.NewReader([]byte(line)))()
+	if err != nil && !errors.Is(err, resproto2.EOF) {
+		return nil, err
+	}
+
+	arr, ok := data.(resproto2.ArrayMsg)
+	if !ok {
+		t.Fatalf("expected ArrayMsg, got %T", data)
+	}
+
+	var args []string
+	for _, elem := range arr.Array() {
+		args = append(args, string(elem.(resproto2.BulkStringMsg).Data()))
+	}
+	return args, nil
+}
+
+func TestInline(t *testing.T) {
+	cases := []struct {
+		line string
+		args []string
+	}{
+		{"PING\r\n", []string{"PING"}},
+		{"set a b\n", []string{"set", "a", "b"}},
+		{"  SET   key\tvalue  \r\n", []string{"SET", "key", "value"}},
+		{"SET \"my key\" 'my value'\r\n", []string{"SET", "my key", "my value"}},
+		{"SET k \"a\\r\\nb\\x41\\\"\"\r\n", []string{"SET", "k", "a\r\nbA\""}},
+		{"SET k 'it\\'s'\r\n", []string{"SET", "k", "it's"}},
+		{"SET k \"\"\r\n", []string{"SET", "k", ""}},
+		{"\r\n\r\nPING\r\n", []string{"PING"}},
+	}
+
+	for _, c := range cases {
+		args, err := inlineArgs(t, c.line)
+		if err != nil {
+			t.Errorf("%q: %v", c.line, err)
+			continue
+		}
+		if len(args) != len(c.args) {
+			t.Errorf("%q: expected %q, got %q", c.line, c.args, args)
+			continue
+		}
+		for i := range args {
+			if args[i] != c.args[i] {
+				t.Errorf("%q: expected %q, got %q", c.line, c.args, args)
+				break
+			}
+		}
+	}
+}
+
+func TestInlineError(t *testing.T) {
+	lines := []string{
+		"SET \"key\r\n",
+		"SET 'key\r\n",
+		"SET \"key\"value\r\n",
+	}
+
+	for _, line := range lines {
+		if _, err := inlineArgs(t, line); !errors.Is(err, resproto2.ErrUnbalancedQuotes) {
+			t.Errorf("%q: expected unbalanced quotes error, got %v", line, err)
+		}
+	}
+
+	_, err := resproto2.ParseRespProto(bytes.NewReader([]byte("%2\r\n")))()
+	if !errors.Is(err, resproto2.ErrUnknownHeaderType) {
+		t.Errorf("expected unknown header type error, got %v", err)
+	}
+}
+
+func TestInlineInArray(t *testing.T) {
+	inputs := []string{
+		"*1\r\nfoo\r\n",
+		"*2\r\n$3\r\nset\r\nkey value\r\n",
+		"*1\r\n*1\r\nPING\r\n",
+		"*1\r\n\r\n$4\r\nPING\r\n",
+	}
+
+	for _, input := range inputs {
+		_, err := resproto2.ParseRespProto(bytes.NewReader([]byte(input)))()
+		if !errors.Is(err, resproto2.ErrUnknownHeaderType) {
+			t.Errorf("%q: expected unknown header type error, got %v", input, err)
+		}
+		if !resproto2.IsProtocolError(err) {
+			t.Errorf("%q: expected protocol error, got %v", input, err)
+		}
+	}
+}
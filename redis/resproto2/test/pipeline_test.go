@@ -0,0 +1,75 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/246859/codis/redis/resproto2"
+	"io"
+	"strings"
+	"testing"
+)
+
+// countWriter counts the times of Write, which is same as the number of write syscalls on a connection
+type countWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Buffer.Write(p)
+}
+
+func TestServePipeline(t *testing.T) {
+	input := strings.Repeat("*1\r\n$4\r\nPING\r\n", 1000)
+	output := new(countWriter)
+
+	reader := resproto2.NewCommandReader(strings.NewReader(input))
+	defer reader.Release()
+	writer := resproto2.NewRespWriter(output)
+
+	executed := 0
+	err := resproto2.Serve(reader, writer, func(args [][]byte, writer *resproto2.RespWriter) error {
+		executed++
+		return writer.WriteStatus("PONG")
+	})
+
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	if executed != 1000 {
+		t.Errorf("expected 1000 commands executed, got %d", executed)
+	}
+
+	if output.String() != strings.Repeat("+PONG\r\n", 1000) {
+		t.Error("unexpected replies")
+	}
+
+	// 16KB read buffer, 10KB write buffer, so the 14KB input and 7KB output need only a few writes
+	if output.writes > 3 {
+		t.Errorf("expected replies to be batched, got %d writes", output.writes)
+	}
+}
+
+func TestServeProtocolError(t *testing.T) {
+	input := "PING\r\n*1\r\n$999999999999\r\n"
+	output := new(countWriter)
+
+	reader := resproto2.NewCommandReader(strings.NewReader(input))
+	defer reader.Release()
+	writer := resproto2.NewRespWriter(output)
+
+	err := resproto2.Serve(reader, writer, func(args [][]byte, writer *resproto2.RespWriter) error {
+		return writer.WriteStatus("PONG")
+	})
+
+	if !errors.Is(err, resproto2.ErrInvalidBulkLength) {
+		t.Errorf("expected invalid bulk length, got %v", err)
+	}
+
+	expected := "+PONG\r\n-ERR Protocol error: invalid bulk length\r\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/246859/codis/redis/resproto2"
+	"testing"
+)
+
+func TestRespWriter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	writer := resproto2.NewRespWriter(buf)
+
+	writer.WriteStatus("OK")
+	writer.WriteError(errors.New("ERR unknown command 'foobar'"))
+	writer.WriteInteger(-1024)
+	writer.WriteBulk([]byte("hello"))
+	writer.WriteBulkString("")
+	writer.WriteNullBulk()
+	writer.WriteArrayHeader(2)
+	writer.WriteArrayHeader(1)
+	writer.WriteBulkString("nested")
+	writer.WriteInteger(1)
+
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing written before flush, got %q", buf.String())
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "+OK\r\n" +
+		"-ERR unknown command 'foobar'\r\n" +
+		":-1024\r\n" +
+		"$5\r\nhello\r\n" +
+		"$0\r\n\r\n" +
+		"$-1\r\n" +
+		"*2\r\n*1\r\n$6\r\nnested\r\n:1\r\n"
+
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestRespWriterData(t *testing.T) {
+	datas := [][]byte{
+		[]byte("+OK\r\n"),
+		[]byte("-ERR error\r\n"),
+		[]byte(":316\r\n"),
+		[]byte("$4\r\n1234\r\n"),
+		[]byte("$-1\r\n"),
+		[]byte("*3\r\n+1st\r\n:2\r\n$3\r\nbar\r\n"),
+	}
+
+	for _, data := range datas {
+		parsed, err := resproto2.ParseRespProto(bytes.NewReader(data))()
+		if err != nil && !errors.Is(err, resproto2.EOF) {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(parsed.Bytes(), data) {
+			t.Errorf("Bytes(): expected %q, got %q", data, parsed.Bytes())
+		}
+
+		buf := bytes.NewBuffer(nil)
+		writer := resproto2.NewRespWriter(buf)
+		if err := writer.WriteData(parsed); err != nil {
+			t.Fatal(err)
+		}
+		writer.Flush()
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("WriteData: expected %q, got %q", data, buf.Bytes())
+		}
+	}
+}
+
+func TestRespWriter_LineInjection(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	writer := resproto2.NewRespWriter(buf)
+
+	writer.WriteStatus("OK\r\n+INJECTED")
+	writer.WriteError(errors.New("ERR bad\r\n:1\n"))
+	writer.Flush()
+
+	expected := "+OK  +INJECTED\r\n-ERR bad  :1 \r\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func BenchmarkRespWriter(b *testing.B) {
+	buf := bytes.NewBuffer(nil)
+	writer := resproto2.NewRespWriter(buf)
+	payload := []byte("hello world")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		writer.WriteArrayHeader(3)
+		writer.WriteBulk(payload)
+		writer.WriteInteger(int64(i))
+		writer.WriteStatus("OK")
+		if writer.Buffered() > 4096 {
+			writer.Flush()
+			buf.Reset()
+		}
+	}
+}
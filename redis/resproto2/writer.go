@@ -0,0 +1,165 @@
+package resproto2
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const defaultWriterSize = 10240
+
+// RespWriter is a buffered RESP2 encoder, replies are written into the buffer
+// directly instead of being built in memory, call Flush to send them out.
+type RespWriter struct {
+	w *bufio.Writer
+	// scratch buffer for formatting integer and length headers
+	scratch []byte
+}
+
+// NewRespWriter returns a RespWriter with default buffer size
+func NewRespWriter(writer io.Writer) *RespWriter {
+	return NewRespWriterSize(writer, defaultWriterSize)
+}
+
+// NewRespWriterSize returns a RespWriter whose buffer has at least the specified size
+func NewRespWriterSize(writer io.Writer, size int) *RespWriter {
+	return &RespWriter{
+		w:       bufio.NewWriterSize(writer, size),
+		scratch: make([]byte, 0, 24),
+	}
+}
+
+// writeHeader write the prefix, a decimal number and CRLF, like $5\r\n or :10\r\n
+func (r *RespWriter) writeHeader(prefix byte, n int64) error {
+	r.scratch = append(r.scratch[:0], prefix)
+	r.scratch = strconv.AppendInt(r.scratch, n, 10)
+	r.scratch = append(r.scratch, CR, LF)
+	_, err := r.w.Write(r.scratch)
+	return err
+}
+
+// writeLine write the prefix, the line and CRLF, the CR and LF in line are replaced by spaces as redis does,
+// otherwise the text could inject extra replies into the stream.
+func (r *RespWriter) writeLine(prefix byte, line string) error {
+	if err := r.w.WriteByte(prefix); err != nil {
+		return err
+	}
+	for i := strings.IndexAny(line, CRLF); i >= 0; i = strings.IndexAny(line, CRLF) {
+		if _, err := r.w.WriteString(line[:i]); err != nil {
+			return err
+		}
+		if err := r.w.WriteByte(' '); err != nil {
+			return err
+		}
+		line = line[i+1:]
+	}
+	if _, err := r.w.WriteString(line); err != nil {
+		return err
+	}
+	_, err := r.w.WriteString(CRLF)
+	return err
+}
+
+// WriteStatus write a simple string, like +OK\r\n
+func (r *RespWriter) WriteStatus(status string) error {
+	return r.writeLine(simpleStringMsg, status)
+}
+
+// WriteError write an error message, like -ERR unknown command\r\n
+func (r *RespWriter) WriteError(err error) error {
+	return r.writeLine(errorMsg, err.Error())
+}
+
+// WriteInteger write an integer, like :1024\r\n
+func (r *RespWriter) WriteInteger(i int64) error {
+	return r.writeHeader(integerMsg, i)
+}
+
+// WriteBulk write a bulk string, like $5\r\nhello\r\n
+func (r *RespWriter) WriteBulk(data []byte) error {
+	if err := r.writeHeader(bulkStringMsg, int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := r.w.Write(data); err != nil {
+		return err
+	}
+	_, err := r.w.WriteString(CRLF)
+	return err
+}
+
+// WriteBulkString is same as WriteBulk, but accepts string to avoid converting
+func (r *RespWriter) WriteBulkString(data string) error {
+	if err := r.writeHeader(bulkStringMsg, int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := r.w.WriteString(data); err != nil {
+		return err
+	}
+	_, err := r.w.WriteString(CRLF)
+	return err
+}
+
+// WriteNullBulk write a null bulk string, $-1\r\n
+func (r *RespWriter) WriteNullBulk() error {
+	return r.writeHeader(bulkStringMsg, -1)
+}
+
+// WriteArrayHeader write the header of an array with n elements, like *3\r\n,
+// the following n elements should be written by caller.
+func (r *RespWriter) WriteArrayHeader(n int) error {
+	return r.writeHeader(arrayMsg, int64(n))
+}
+
+// WriteNullArray write a null array, *-1\r\n
+func (r *RespWriter) WriteNullArray() error {
+	return r.writeHeader(arrayMsg, -1)
+}
+
+// WriteData write a parsed Data
+func (r *RespWriter) WriteData(data Data) error {
+	switch d := data.(type) {
+	case StatusMsg:
+		return r.WriteStatus(d.status)
+	case ErrorMsg:
+		return r.WriteError(d.err)
+	case IntegerMsg:
+		return r.WriteInteger(d.i)
+	case BulkStringMsg:
+		if d.IsNull() {
+			return r.WriteNullBulk()
+		}
+		return r.WriteBulk(d.data)
+	case ArrayMsg:
+		if d.len < 0 {
+			return r.WriteNullArray()
+		}
+		if err := r.WriteArrayHeader(len(d.arr)); err != nil {
+			return err
+		}
+		for _, elem := range d.arr {
+			if err := r.WriteData(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		_, err := r.w.Write(data.Bytes())
+		return err
+	}
+}
+
+// Buffered returns the number of bytes that have been written into the buffer but not flushed
+func (r *RespWriter) Buffered() int {
+	return r.w.Buffered()
+}
+
+// Flush write the buffered data to the underlying writer
+func (r *RespWriter) Flush() error {
+	return r.w.Flush()
+}
+
+// Reset discards any unflushed data and switch to write to w
+func (r *RespWriter) Reset(w io.Writer) {
+	r.w.Reset(w)
+}
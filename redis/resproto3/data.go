@@ -0,0 +1,293 @@
+package resproto3
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+type Data interface {
+	Bytes() []byte
+}
+
+type StatusMsg struct {
+	status string
+}
+
+func (s StatusMsg) Bytes() []byte {
+	return []byte(string(simpleStringMsg) + s.status + CRLF)
+}
+
+func (s StatusMsg) Status() string {
+	return s.status
+}
+
+type IntegerMsg struct {
+	i int64
+}
+
+func (i IntegerMsg) Bytes() []byte {
+	return []byte(string(integerMsg) + strconv.FormatInt(i.i, 10) + CRLF)
+}
+
+func (i IntegerMsg) Int64() int64 {
+	return i.i
+}
+
+type ErrorMsg struct {
+	err error
+}
+
+func (e ErrorMsg) Bytes() []byte {
+	return []byte(string(errorMsg) + e.err.Error() + CRLF)
+}
+
+func (e ErrorMsg) Error() error {
+	return e.err
+}
+
+type BulkStringMsg struct {
+	data []byte
+	len  int64
+}
+
+func (b BulkStringMsg) Len() int64 {
+	return b.len
+}
+
+func (b BulkStringMsg) Data() []byte {
+	return b.data
+}
+
+// IsNull reports whether it is a RESP2 style null bulk string, $-1\r\n
+func (b BulkStringMsg) IsNull() bool {
+	return b.len < 0
+}
+
+func (b BulkStringMsg) Bytes() []byte {
+	var bs []byte
+	bs = append(bs, fmt.Sprintf("%c%d\r\n", bulkStringMsg, b.len)...)
+	if b.len < 0 {
+		return bs
+	}
+	bs = append(bs, b.data...)
+	bs = append(bs, CRLF...)
+	return bs
+}
+
+type ArrayMsg struct {
+	arr []Data
+	len int64
+}
+
+func (a ArrayMsg) Len() int64 {
+	return a.len
+}
+
+func (a ArrayMsg) Array() []Data {
+	return a.arr
+}
+
+func (a ArrayMsg) Bytes() []byte {
+	return aggregateBytes(arrayMsg, a.len, a.arr)
+}
+
+// NullMsg is the RESP3 null type, _\r\n
+type NullMsg struct{}
+
+func (n NullMsg) Bytes() []byte {
+	return []byte(string(nullMsg) + CRLF)
+}
+
+// DoubleMsg is a floating point number, like ,1.23\r\n
+type DoubleMsg struct {
+	f float64
+}
+
+func (d DoubleMsg) Bytes() []byte {
+	return []byte(string(doubleMsg) + formatDouble(d.f) + CRLF)
+}
+
+func (d DoubleMsg) Float64() float64 {
+	return d.f
+}
+
+// BooleanMsg is a boolean value, #t\r\n or #f\r\n
+type BooleanMsg struct {
+	b bool
+}
+
+func (b BooleanMsg) Bytes() []byte {
+	if b.b {
+		return []byte(string(booleanMsg) + "t" + CRLF)
+	}
+	return []byte(string(booleanMsg) + "f" + CRLF)
+}
+
+func (b BooleanMsg) Bool() bool {
+	return b.b
+}
+
+// BigNumberMsg is a integer out of range of int64, like (3492890328409238509324850943850943825024385\r\n
+type BigNumberMsg struct {
+	n *big.Int
+}
+
+func (b BigNumberMsg) Bytes() []byte {
+	return []byte(string(bigNumberMsg) + b.n.String() + CRLF)
+}
+
+func (b BigNumberMsg) BigInt() *big.Int {
+	return b.n
+}
+
+// VerbatimStringMsg is a bulk string with a three bytes format, like =15\r\ntxt:Some string\r\n
+type VerbatimStringMsg struct {
+	format string
+	data   []byte
+}
+
+func (v VerbatimStringMsg) Bytes() []byte {
+	var bs []byte
+	bs = append(bs, fmt.Sprintf("%c%d\r\n", verbatimStringMsg, len(v.format)+1+len(v.data))...)
+	bs = append(bs, v.format...)
+	bs = append(bs, ':')
+	bs = append(bs, v.data...)
+	bs = append(bs, CRLF...)
+	return bs
+}
+
+func (v VerbatimStringMsg) Format() string {
+	return v.format
+}
+
+func (v VerbatimStringMsg) Data() []byte {
+	return v.data
+}
+
+// BlobErrorMsg is an error in bulk form, like !21\r\nSYNTAX invalid syntax\r\n
+type BlobErrorMsg struct {
+	err error
+}
+
+func (b BlobErrorMsg) Bytes() []byte {
+	msg := b.err.Error()
+	return []byte(fmt.Sprintf("%c%d\r\n%s\r\n", blobErrorMsg, len(msg), msg))
+}
+
+func (b BlobErrorMsg) Error() error {
+	return b.err
+}
+
+// MapEntry is a key-value pair of map or attribute
+type MapEntry struct {
+	Key   Data
+	Value Data
+}
+
+// MapMsg is an ordered sequence of key-value pairs, like %2\r\n+first\r\n:1\r\n+second\r\n:2\r\n
+type MapMsg struct {
+	entries []MapEntry
+}
+
+func (m MapMsg) Len() int64 {
+	return int64(len(m.entries))
+}
+
+func (m MapMsg) Entries() []MapEntry {
+	return m.entries
+}
+
+func (m MapMsg) Bytes() []byte {
+	return entriesBytes(mapMsg, m.entries)
+}
+
+// SetMsg is an unordered collection of elements, like ~2\r\n+orange\r\n+apple\r\n
+type SetMsg struct {
+	arr []Data
+}
+
+func (s SetMsg) Len() int64 {
+	return int64(len(s.arr))
+}
+
+func (s SetMsg) Array() []Data {
+	return s.arr
+}
+
+func (s SetMsg) Bytes() []byte {
+	return aggregateBytes(setMsg, int64(len(s.arr)), s.arr)
+}
+
+// AttributeMsg is the auxiliary key-value pairs attached to the following reply,
+// like |1\r\n+key-popularity\r\n%1\r\n$1\r\na\r\n,0.1923\r\n*1\r\n:2039123\r\n
+type AttributeMsg struct {
+	entries []MapEntry
+	data    Data
+}
+
+func (a AttributeMsg) Entries() []MapEntry {
+	return a.entries
+}
+
+// Data returns the actual reply which the attribute is attached to
+func (a AttributeMsg) Data() Data {
+	return a.data
+}
+
+func (a AttributeMsg) Bytes() []byte {
+	bs := entriesBytes(attributeMsg, a.entries)
+	if a.data != nil {
+		bs = append(bs, a.data.Bytes()...)
+	}
+	return bs
+}
+
+// PushMsg is out of band data sent by server, like >2\r\n+message\r\n+hello\r\n
+type PushMsg struct {
+	arr []Data
+}
+
+func (p PushMsg) Len() int64 {
+	return int64(len(p.arr))
+}
+
+func (p PushMsg) Array() []Data {
+	return p.arr
+}
+
+func (p PushMsg) Bytes() []byte {
+	return aggregateBytes(pushMsg, int64(len(p.arr)), p.arr)
+}
+
+func aggregateBytes(prefix byte, n int64, arr []Data) []byte {
+	var b []byte
+	b = append(b, fmt.Sprintf("%c%d\r\n", prefix, n)...)
+	for _, data := range arr {
+		b = append(b, data.Bytes()...)
+	}
+	return b
+}
+
+func entriesBytes(prefix byte, entries []MapEntry) []byte {
+	var b []byte
+	b = append(b, fmt.Sprintf("%c%d\r\n", prefix, len(entries))...)
+	for _, entry := range entries {
+		b = append(b, entry.Key.Bytes()...)
+		b = append(b, entry.Value.Bytes()...)
+	}
+	return b
+}
+
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
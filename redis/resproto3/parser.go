@@ -0,0 +1,358 @@
+package resproto3
+
+import (
+	"bufio"
+	"errors"
+	"github.com/246859/codis/redis/resproto2"
+	errors2 "github.com/pkg/errors"
+	"io"
+	"math"
+	"math/big"
+	"net/textproto"
+	"strconv"
+)
+
+const (
+	CRLF = "\r\n"
+
+	CR = '\r'
+	LF = '\n'
+
+	// RESP2 types
+	simpleStringMsg = '+'
+	errorMsg        = '-'
+	integerMsg      = ':'
+	bulkStringMsg   = '$'
+	arrayMsg        = '*'
+
+	// RESP3 types
+	nullMsg           = '_'
+	doubleMsg         = ','
+	booleanMsg        = '#'
+	blobErrorMsg      = '!'
+	verbatimStringMsg = '='
+	bigNumberMsg      = '('
+	mapMsg            = '%'
+	setMsg            = '~'
+	attributeMsg      = '|'
+	pushMsg           = '>'
+)
+
+var (
+	ErrInvalidReader      = errors.New("invalid reader")
+	ErrInvalidHeader      = errors.New("invalid header")
+	ErrMismatchHeaderType = errors.New("mismatch header type")
+	ErrUnknownHeaderType  = errors.New("unknown header type")
+	// EOF represent an individual message parse completed
+	EOF = errors.New("RESP EOF")
+)
+
+type RespIterator func() (Data, error)
+
+// ParseRespProto RESP3 Protocol parser with resproto2.DefaultLimits, it can parse RESP2 messages too,
+// because RESP3 is a superset of RESP2.
+func ParseRespProto(reader io.Reader) RespIterator {
+	return ParseRespProtoLimits(reader, resproto2.DefaultLimits)
+}
+
+// ParseRespProtoLimits RESP3 Protocol parser with the specified limits, the limits are the same as RESP2,
+// the aggregate types share MaxMultiBulkLen and MaxDepth, and the blob types share MaxBulkLen.
+// It returns a *resproto2.ProtocolError once the input exceeds the limits.
+func ParseRespProtoLimits(reader io.Reader, limits resproto2.Limits) RespIterator {
+	respReader := textproto.NewReader(bufio.NewReaderSize(reader, 10240))
+	return parse(respReader, limits.WithDefaults(), 0)
+}
+
+func parse(reader *textproto.Reader, limits resproto2.Limits, depth int) RespIterator {
+
+	return func() (Data, error) {
+		// it will clear the CRLF
+		header, err := resproto2.ReadLine(reader.R, limits.MaxInlineLen)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(header) == 0 {
+			return nil, ErrInvalidHeader
+		}
+
+		var (
+			data     Data
+			parseErr error
+		)
+
+		switch header[0] {
+		case simpleStringMsg:
+			data, parseErr = StatusMsg{status: string(header[1:])}, EOF
+		case errorMsg:
+			data, parseErr = ErrorMsg{err: errors.New(string(header[1:]))}, EOF
+		case integerMsg:
+			data, parseErr = parseInteger(header)
+		case bulkStringMsg:
+			data, parseErr = parseBulkString(header, reader, limits)
+		case arrayMsg:
+			data, parseErr = parseArray(header, reader, limits, depth)
+		case nullMsg:
+			data, parseErr = parseNull(header)
+		case doubleMsg:
+			data, parseErr = parseDouble(header)
+		case booleanMsg:
+			data, parseErr = parseBoolean(header)
+		case bigNumberMsg:
+			data, parseErr = parseBigNumber(header)
+		case blobErrorMsg:
+			data, parseErr = parseBlobError(header, reader, limits)
+		case verbatimStringMsg:
+			data, parseErr = parseVerbatimString(header, reader, limits)
+		case mapMsg:
+			data, parseErr = parseMap(header, reader, limits, depth)
+		case setMsg:
+			data, parseErr = parseSet(header, reader, limits, depth)
+		case attributeMsg:
+			data, parseErr = parseAttribute(header, reader, limits, depth)
+		case pushMsg:
+			data, parseErr = parsePush(header, reader, limits, depth)
+		default:
+			parseErr = errors2.Wrap(ErrUnknownHeaderType, strconv.Quote(string(header[0])))
+		}
+
+		return data, parseErr
+	}
+}
+
+// parseLength parse the length part of header, like $5 or *3
+func parseLength(header []byte) (int64, error) {
+	return strconv.ParseInt(string(header[1:]), 10, 64)
+}
+
+// parseAggregateLength parse the length of an aggregate type, the length is checked before
+// anything is allocated for the elements, and so is the nesting depth.
+func parseAggregateLength(header []byte, limits resproto2.Limits, depth int) (int64, error) {
+	contentLen, err := parseLength(header)
+	if err != nil || contentLen < -1 || contentLen > limits.MaxMultiBulkLen {
+		return 0, resproto2.ErrInvalidMultiBulkLength
+	} else if depth >= limits.MaxDepth {
+		return 0, resproto2.ErrTooDeepNesting
+	}
+	return contentLen, nil
+}
+
+// readBlob read data with specific length and the trailing CRLF, the length is checked before allocating
+func readBlob(header []byte, reader *textproto.Reader, limits resproto2.Limits) ([]byte, int64, error) {
+	contentLen, err := parseLength(header)
+	if err != nil || contentLen < -1 || contentLen > limits.MaxBulkLen {
+		return nil, 0, resproto2.ErrInvalidBulkLength
+	}
+
+	if contentLen < 0 {
+		return nil, contentLen, nil
+	}
+
+	content := make([]byte, contentLen+int64(len(CRLF)))
+	if _, err := io.ReadFull(reader.R, content); err != nil {
+		return nil, 0, err
+	}
+
+	return content[:contentLen], contentLen, nil
+}
+
+func parseInteger(header []byte) (IntegerMsg, error) {
+	i, err := strconv.ParseInt(string(header[1:]), 10, 64)
+	if err != nil {
+		return IntegerMsg{}, err
+	}
+	return IntegerMsg{i: i}, EOF
+}
+
+func parseBulkString(header []byte, reader *textproto.Reader, limits resproto2.Limits) (BulkStringMsg, error) {
+	data, contentLen, err := readBlob(header, reader, limits)
+	if err != nil {
+		return BulkStringMsg{}, err
+	}
+	return BulkStringMsg{data: data, len: contentLen}, EOF
+}
+
+func parseNull(header []byte) (NullMsg, error) {
+	if len(header) != 1 {
+		return NullMsg{}, errors2.Wrap(ErrInvalidHeader, string(header))
+	}
+	return NullMsg{}, EOF
+}
+
+func parseDouble(header []byte) (DoubleMsg, error) {
+	switch str := string(header[1:]); str {
+	case "inf":
+		return DoubleMsg{f: math.Inf(1)}, EOF
+	case "-inf":
+		return DoubleMsg{f: math.Inf(-1)}, EOF
+	case "nan":
+		return DoubleMsg{f: math.NaN()}, EOF
+	default:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return DoubleMsg{}, err
+		}
+		return DoubleMsg{f: f}, EOF
+	}
+}
+
+func parseBoolean(header []byte) (BooleanMsg, error) {
+	switch string(header[1:]) {
+	case "t":
+		return BooleanMsg{b: true}, EOF
+	case "f":
+		return BooleanMsg{b: false}, EOF
+	default:
+		return BooleanMsg{}, errors2.Wrap(ErrInvalidHeader, string(header))
+	}
+}
+
+func parseBigNumber(header []byte) (BigNumberMsg, error) {
+	n, ok := new(big.Int).SetString(string(header[1:]), 10)
+	if !ok {
+		return BigNumberMsg{}, errors2.Wrap(ErrInvalidHeader, string(header))
+	}
+	return BigNumberMsg{n: n}, EOF
+}
+
+func parseBlobError(header []byte, reader *textproto.Reader, limits resproto2.Limits) (BlobErrorMsg, error) {
+	data, contentLen, err := readBlob(header, reader, limits)
+	if err != nil {
+		return BlobErrorMsg{}, err
+	} else if contentLen < 0 {
+		return BlobErrorMsg{}, errors2.Wrap(ErrInvalidHeader, string(header))
+	}
+	return BlobErrorMsg{err: errors.New(string(data))}, EOF
+}
+
+func parseVerbatimString(header []byte, reader *textproto.Reader, limits resproto2.Limits) (VerbatimStringMsg, error) {
+	data, _, err := readBlob(header, reader, limits)
+	if err != nil {
+		return VerbatimStringMsg{}, err
+	}
+	// the first three bytes are format, followed by a colon
+	if len(data) < 4 || data[3] != ':' {
+		return VerbatimStringMsg{}, errors2.Wrap(ErrInvalidHeader, string(header))
+	}
+	return VerbatimStringMsg{format: string(data[:3]), data: data[4:]}, EOF
+}
+
+// parseElements parse the following n messages one level deeper
+func parseElements(n int64, reader *textproto.Reader, limits resproto2.Limits, depth int) ([]Data, error) {
+	var dataList []Data
+
+	next := parse(reader, limits, depth+1)
+
+	for i := int64(0); i < n; i++ {
+		data, err := next()
+		if err != nil && !errors.Is(err, EOF) {
+			return nil, err
+		}
+		dataList = append(dataList, data)
+	}
+
+	return dataList, nil
+}
+
+// parseEntries parse the following n key-value pairs
+func parseEntries(n int64, reader *textproto.Reader, limits resproto2.Limits, depth int) ([]MapEntry, error) {
+	if n < 0 {
+		return nil, ErrInvalidHeader
+	}
+
+	dataList, err := parseElements(n*2, reader, limits, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]MapEntry, 0, n)
+	for i := 0; i < len(dataList); i += 2 {
+		entries = append(entries, MapEntry{Key: dataList[i], Value: dataList[i+1]})
+	}
+	return entries, nil
+}
+
+func parseArray(header []byte, reader *textproto.Reader, limits resproto2.Limits, depth int) (ArrayMsg, error) {
+	contentLen, err := parseAggregateLength(header, limits, depth)
+	if err != nil {
+		return ArrayMsg{}, err
+	}
+
+	if contentLen < 0 {
+		return ArrayMsg{len: contentLen}, EOF
+	}
+
+	dataList, err := parseElements(contentLen, reader, limits, depth)
+	if err != nil {
+		return ArrayMsg{}, err
+	}
+
+	return ArrayMsg{arr: dataList, len: contentLen}, EOF
+}
+
+func parseSet(header []byte, reader *textproto.Reader, limits resproto2.Limits, depth int) (SetMsg, error) {
+	contentLen, err := parseAggregateLength(header, limits, depth)
+	if err != nil {
+		return SetMsg{}, err
+	} else if contentLen < 0 {
+		return SetMsg{}, errors2.Wrap(ErrInvalidHeader, string(header))
+	}
+
+	dataList, err := parseElements(contentLen, reader, limits, depth)
+	if err != nil {
+		return SetMsg{}, err
+	}
+
+	return SetMsg{arr: dataList}, EOF
+}
+
+func parsePush(header []byte, reader *textproto.Reader, limits resproto2.Limits, depth int) (PushMsg, error) {
+	contentLen, err := parseAggregateLength(header, limits, depth)
+	if err != nil {
+		return PushMsg{}, err
+	} else if contentLen < 0 {
+		return PushMsg{}, errors2.Wrap(ErrInvalidHeader, string(header))
+	}
+
+	dataList, err := parseElements(contentLen, reader, limits, depth)
+	if err != nil {
+		return PushMsg{}, err
+	}
+
+	return PushMsg{arr: dataList}, EOF
+}
+
+func parseMap(header []byte, reader *textproto.Reader, limits resproto2.Limits, depth int) (MapMsg, error) {
+	contentLen, err := parseAggregateLength(header, limits, depth)
+	if err != nil {
+		return MapMsg{}, err
+	}
+
+	entries, err := parseEntries(contentLen, reader, limits, depth)
+	if err != nil {
+		return MapMsg{}, err
+	}
+
+	return MapMsg{entries: entries}, EOF
+}
+
+// parseAttribute parse the attribute and the reply followed it
+func parseAttribute(header []byte, reader *textproto.Reader, limits resproto2.Limits, depth int) (AttributeMsg, error) {
+	contentLen, err := parseAggregateLength(header, limits, depth)
+	if err != nil {
+		return AttributeMsg{}, err
+	}
+
+	entries, err := parseEntries(contentLen, reader, limits, depth)
+	if err != nil {
+		return AttributeMsg{}, err
+	}
+
+	// the attributed reply is at the same level as the attribute
+	data, err := parse(reader, limits, depth)()
+	if err != nil && !errors.Is(err, EOF) {
+		return AttributeMsg{}, err
+	}
+
+	return AttributeMsg{entries: entries, data: data}, EOF
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/246859/codis/redis/resproto2"
+	"github.com/246859/codis/redis/resproto3"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	limits := resproto2.Limits{
+		MaxBulkLen:      16,
+		MaxMultiBulkLen: 4,
+		MaxDepth:        2,
+		MaxInlineLen:    32,
+	}
+
+	cases := []struct {
+		input string
+		err   error
+	}{
+		{"$9999999999\r\n", resproto2.ErrInvalidBulkLength},
+		{"!17\r\n", resproto2.ErrInvalidBulkLength},
+		{"=-2\r\n", resproto2.ErrInvalidBulkLength},
+		{"*2147483647\r\n", resproto2.ErrInvalidMultiBulkLength},
+		{"%5\r\n", resproto2.ErrInvalidMultiBulkLength},
+		{"~abc\r\n", resproto2.ErrInvalidMultiBulkLength},
+		{">-5\r\n", resproto2.ErrInvalidMultiBulkLength},
+		{"*1\r\n%1\r\n~1\r\n:1\r\n", resproto2.ErrTooDeepNesting},
+		{"|1\r\n+k\r\n*1\r\n*1\r\n*1\r\n:1\r\n", resproto2.ErrTooDeepNesting},
+		{"*1\r\n$17\r\n", resproto2.ErrInvalidBulkLength},
+		{"+" + strings.Repeat("a", 64) + "\r\n", resproto2.ErrTooBigInlineRequest},
+	}
+
+	for _, c := range cases {
+		_, err := resproto3.ParseRespProtoLimits(bytes.NewReader([]byte(c.input)), limits)()
+		if !errors.Is(err, c.err) {
+			t.Errorf("%q: expected %v, got %v", c.input, c.err, err)
+		}
+		if !resproto2.IsProtocolError(err) {
+			t.Errorf("%q: expected protocol error, got %v", c.input, err)
+		}
+	}
+
+	valid := []string{
+		"$16\r\n" + strings.Repeat("a", 16) + "\r\n",
+		"%2\r\n:1\r\n:2\r\n:3\r\n:4\r\n",
+		"*1\r\n~1\r\n:1\r\n",
+		"|1\r\n+k\r\n:1\r\n*1\r\n*1\r\n:1\r\n",
+	}
+
+	for _, input := range valid {
+		_, err := resproto3.ParseRespProtoLimits(bytes.NewReader([]byte(input)), limits)()
+		if err != nil && !errors.Is(err, resproto3.EOF) {
+			t.Errorf("%q: unexpected error %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/246859/codis/redis/resproto3"
+	"math/big"
+	"testing"
+)
+
+func parseOne(t *testing.T, data []byte) resproto3.Data {
+	parsed, err := resproto3.ParseRespProto(bytes.NewReader(data))()
+	if err != nil && !errors.Is(err, resproto3.EOF) {
+		t.Fatalf("parse %q: %v", data, err)
+	}
+	return parsed
+}
+
+func TestParseResp3(t *testing.T) {
+	datas := [][]byte{
+		[]byte("+OK\r\n"),
+		[]byte("-ERR error\r\n"),
+		[]byte(":316\r\n"),
+		[]byte("$4\r\n1234\r\n"),
+		[]byte("*2\r\n+1st\r\n:2\r\n"),
+		[]byte("_\r\n"),
+		[]byte(",3.14\r\n"),
+		[]byte(",inf\r\n"),
+		[]byte(",-inf\r\n"),
+		[]byte("#t\r\n"),
+		[]byte("#f\r\n"),
+		[]byte("(3492890328409238509324850943850943825024385\r\n"),
+		[]byte("=15\r\ntxt:Some string\r\n"),
+		[]byte("!21\r\nSYNTAX invalid syntax\r\n"),
+		[]byte("%2\r\n+first\r\n:1\r\n+second\r\n:2\r\n"),
+		[]byte("~2\r\n+orange\r\n+apple\r\n"),
+		[]byte(">2\r\n+message\r\n$5\r\nhello\r\n"),
+		[]byte("|1\r\n+key-popularity\r\n%1\r\n$1\r\na\r\n,0.1923\r\n*1\r\n:2039123\r\n"),
+		[]byte("*2\r\n%1\r\n+k\r\n~1\r\n#t\r\n_\r\n"),
+	}
+
+	for _, data := range datas {
+		parsed := parseOne(t, data)
+
+		if !bytes.Equal(parsed.Bytes(), data) {
+			t.Errorf("Bytes(): expected %q, got %q", data, parsed.Bytes())
+		}
+
+		buf := bytes.NewBuffer(nil)
+		writer := resproto3.NewRespWriter(buf)
+		writer.SetVersion(resproto3.Resp3)
+		if err := writer.WriteData(parsed); err != nil {
+			t.Fatal(err)
+		}
+		writer.Flush()
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("WriteData: expected %q, got %q", data, buf.Bytes())
+		}
+	}
+}
+
+func TestParseResp3Types(t *testing.T) {
+	if d, ok := parseOne(t, []byte(",1.5\r\n")).(resproto3.DoubleMsg); !ok || d.Float64() != 1.5 {
+		t.Errorf("unexpected double %v", d)
+	}
+
+	if b, ok := parseOne(t, []byte("#t\r\n")).(resproto3.BooleanMsg); !ok || !b.Bool() {
+		t.Errorf("unexpected boolean %v", b)
+	}
+
+	v, ok := parseOne(t, []byte("=9\r\nmkd:hello\r\n")).(resproto3.VerbatimStringMsg)
+	if !ok || v.Format() != "mkd" || string(v.Data()) != "hello" {
+		t.Errorf("unexpected verbatim string %v", v)
+	}
+
+	m, ok := parseOne(t, []byte("%1\r\n+a\r\n:1\r\n")).(resproto3.MapMsg)
+	if !ok || m.Len() != 1 || m.Entries()[0].Value.(resproto3.IntegerMsg).Int64() != 1 {
+		t.Errorf("unexpected map %v", m)
+	}
+
+	a, ok := parseOne(t, []byte("|1\r\n+ttl\r\n:10\r\n+OK\r\n")).(resproto3.AttributeMsg)
+	if !ok || a.Data().(resproto3.StatusMsg).Status() != "OK" {
+		t.Errorf("unexpected attribute %v", a)
+	}
+
+	_, err := resproto3.ParseRespProto(bytes.NewReader([]byte("?abc\r\n")))()
+	if !errors.Is(err, resproto3.ErrUnknownHeaderType) {
+		t.Errorf("expected unknown header type error, got %v", err)
+	}
+}
+
+func TestRespWriterVersion(t *testing.T) {
+	write := func(version resproto3.Version) string {
+		buf := bytes.NewBuffer(nil)
+		writer := resproto3.NewRespWriter(buf)
+		writer.SetVersion(version)
+		writer.WriteMapHeader(1)
+		writer.WriteBulkString("k")
+		writer.WriteDouble(1.5)
+		writer.WriteSetHeader(2)
+		writer.WriteBoolean(true)
+		writer.WriteNull()
+		writer.WriteBigNumber(big.NewInt(100))
+		writer.WriteVerbatim("txt", "hi")
+		writer.WriteBlobError(errors.New("ERR a\nb"))
+		writer.WritePushHeader(0)
+		writer.Flush()
+		return buf.String()
+	}
+
+	resp2 := "*2\r\n$1\r\nk\r\n$3\r\n1.5\r\n" +
+		"*2\r\n:1\r\n$-1\r\n" +
+		"$3\r\n100\r\n" +
+		"$2\r\nhi\r\n" +
+		"-ERR a b\r\n" +
+		"*0\r\n"
+	if got := write(resproto3.Resp2); got != resp2 {
+		t.Errorf("RESP2: expected %q, got %q", resp2, got)
+	}
+
+	resp3 := "%1\r\n$1\r\nk\r\n,1.5\r\n" +
+		"~2\r\n#t\r\n_\r\n" +
+		"(100\r\n" +
+		"=6\r\ntxt:hi\r\n" +
+		"!7\r\nERR a\nb\r\n" +
+		">0\r\n"
+	if got := write(resproto3.Resp3); got != resp3 {
+		t.Errorf("RESP3: expected %q, got %q", resp3, got)
+	}
+
+	writer := resproto3.NewRespWriter(bytes.NewBuffer(nil))
+	if err := writer.WriteAttributeHeader(1); !errors.Is(err, resproto3.ErrAttributeInResp2) {
+		t.Errorf("expected attribute error in RESP2, got %v", err)
+	}
+	if err := writer.SetVersion(4); !errors.Is(err, resproto3.ErrUnsupportedVersion) {
+		t.Errorf("expected unsupported version error, got %v", err)
+	}
+}
@@ -0,0 +1,343 @@
+package resproto3
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Version is the RESP protocol version used by a connection
+type Version int
+
+const (
+	Resp2 Version = 2
+	Resp3 Version = 3
+)
+
+const defaultWriterSize = 10240
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+	ErrAttributeInResp2   = errors.New("attribute is not supported in RESP2")
+)
+
+// RespWriter is a buffered RESP encoder. The protocol version can be switched at runtime,
+// e.g. after HELLO 3, the RESP3 types will be downgraded to RESP2 types in RESP2 mode.
+type RespWriter struct {
+	w       *bufio.Writer
+	version Version
+	// scratch buffer for formatting integer and length headers
+	scratch []byte
+}
+
+// NewRespWriter returns a RespWriter with default buffer size and RESP2 version
+func NewRespWriter(writer io.Writer) *RespWriter {
+	return NewRespWriterSize(writer, defaultWriterSize)
+}
+
+// NewRespWriterSize returns a RespWriter whose buffer has at least the specified size
+func NewRespWriterSize(writer io.Writer, size int) *RespWriter {
+	return &RespWriter{
+		w:       bufio.NewWriterSize(writer, size),
+		version: Resp2,
+		scratch: make([]byte, 0, 32),
+	}
+}
+
+// SetVersion switch the protocol version of the following replies
+func (r *RespWriter) SetVersion(version Version) error {
+	if version != Resp2 && version != Resp3 {
+		return ErrUnsupportedVersion
+	}
+	r.version = version
+	return nil
+}
+
+func (r *RespWriter) Version() Version {
+	return r.version
+}
+
+func (r *RespWriter) writeHeader(prefix byte, n int64) error {
+	r.scratch = append(r.scratch[:0], prefix)
+	r.scratch = strconv.AppendInt(r.scratch, n, 10)
+	r.scratch = append(r.scratch, CR, LF)
+	_, err := r.w.Write(r.scratch)
+	return err
+}
+
+// writeLine write the prefix, the line and CRLF, the CR and LF in line are replaced by spaces as redis does
+func (r *RespWriter) writeLine(prefix byte, line string) error {
+	if err := r.w.WriteByte(prefix); err != nil {
+		return err
+	}
+	for i := strings.IndexAny(line, CRLF); i >= 0; i = strings.IndexAny(line, CRLF) {
+		if _, err := r.w.WriteString(line[:i]); err != nil {
+			return err
+		}
+		if err := r.w.WriteByte(' '); err != nil {
+			return err
+		}
+		line = line[i+1:]
+	}
+	if _, err := r.w.WriteString(line); err != nil {
+		return err
+	}
+	_, err := r.w.WriteString(CRLF)
+	return err
+}
+
+func (r *RespWriter) writeBlob(prefix byte, data string) error {
+	if err := r.writeHeader(prefix, int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := r.w.WriteString(data); err != nil {
+		return err
+	}
+	_, err := r.w.WriteString(CRLF)
+	return err
+}
+
+// WriteStatus write a simple string, like +OK\r\n
+func (r *RespWriter) WriteStatus(status string) error {
+	return r.writeLine(simpleStringMsg, status)
+}
+
+// WriteError write a simple error, like -ERR unknown command\r\n
+func (r *RespWriter) WriteError(err error) error {
+	return r.writeLine(errorMsg, err.Error())
+}
+
+// WriteInteger write an integer, like :1024\r\n
+func (r *RespWriter) WriteInteger(i int64) error {
+	return r.writeHeader(integerMsg, i)
+}
+
+// WriteBulk write a bulk string, like $5\r\nhello\r\n
+func (r *RespWriter) WriteBulk(data []byte) error {
+	if err := r.writeHeader(bulkStringMsg, int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := r.w.Write(data); err != nil {
+		return err
+	}
+	_, err := r.w.WriteString(CRLF)
+	return err
+}
+
+// WriteBulkString is same as WriteBulk, but accepts string to avoid converting
+func (r *RespWriter) WriteBulkString(data string) error {
+	return r.writeBlob(bulkStringMsg, data)
+}
+
+// WriteNull write a null, _\r\n in RESP3, $-1\r\n in RESP2
+func (r *RespWriter) WriteNull() error {
+	if r.version == Resp2 {
+		return r.writeHeader(bulkStringMsg, -1)
+	}
+	_, err := r.w.WriteString(string(nullMsg) + CRLF)
+	return err
+}
+
+// WriteNullArray write a null array, _\r\n in RESP3, *-1\r\n in RESP2
+func (r *RespWriter) WriteNullArray() error {
+	if r.version == Resp2 {
+		return r.writeHeader(arrayMsg, -1)
+	}
+	return r.WriteNull()
+}
+
+// WriteArrayHeader write the header of an array with n elements, like *3\r\n
+func (r *RespWriter) WriteArrayHeader(n int) error {
+	return r.writeHeader(arrayMsg, int64(n))
+}
+
+// WriteMapHeader write the header of a map with n key-value pairs, like %2\r\n,
+// in RESP2 it will be a flat array with 2*n elements.
+func (r *RespWriter) WriteMapHeader(n int) error {
+	if r.version == Resp2 {
+		return r.writeHeader(arrayMsg, int64(n)*2)
+	}
+	return r.writeHeader(mapMsg, int64(n))
+}
+
+// WriteSetHeader write the header of a set with n elements, like ~3\r\n, it is an array in RESP2.
+func (r *RespWriter) WriteSetHeader(n int) error {
+	if r.version == Resp2 {
+		return r.writeHeader(arrayMsg, int64(n))
+	}
+	return r.writeHeader(setMsg, int64(n))
+}
+
+// WritePushHeader write the header of a push message with n elements, like >3\r\n, it is an array in RESP2.
+func (r *RespWriter) WritePushHeader(n int) error {
+	if r.version == Resp2 {
+		return r.writeHeader(arrayMsg, int64(n))
+	}
+	return r.writeHeader(pushMsg, int64(n))
+}
+
+// WriteAttributeHeader write the header of attribute with n key-value pairs, like |1\r\n,
+// the attribute must be followed by a reply, and it is not allowed in RESP2.
+func (r *RespWriter) WriteAttributeHeader(n int) error {
+	if r.version == Resp2 {
+		return ErrAttributeInResp2
+	}
+	return r.writeHeader(attributeMsg, int64(n))
+}
+
+// WriteDouble write a double, like ,3.14\r\n, it is a bulk string in RESP2.
+func (r *RespWriter) WriteDouble(f float64) error {
+	if r.version == Resp2 {
+		return r.writeBlob(bulkStringMsg, formatDouble(f))
+	}
+	return r.writeLine(doubleMsg, formatDouble(f))
+}
+
+// WriteBoolean write a boolean, #t\r\n or #f\r\n, it is integer 1 or 0 in RESP2.
+func (r *RespWriter) WriteBoolean(b bool) error {
+	if r.version == Resp2 {
+		if b {
+			return r.WriteInteger(1)
+		}
+		return r.WriteInteger(0)
+	}
+	if b {
+		return r.writeLine(booleanMsg, "t")
+	}
+	return r.writeLine(booleanMsg, "f")
+}
+
+// WriteBigNumber write a big number, like (12345678901234567890\r\n, it is a bulk string in RESP2.
+func (r *RespWriter) WriteBigNumber(n *big.Int) error {
+	if r.version == Resp2 {
+		return r.writeBlob(bulkStringMsg, n.String())
+	}
+	return r.writeLine(bigNumberMsg, n.String())
+}
+
+// WriteVerbatim write a verbatim string with a three bytes format like txt or mkd,
+// it is a bulk string without format in RESP2.
+func (r *RespWriter) WriteVerbatim(format string, data string) error {
+	if r.version == Resp2 {
+		return r.writeBlob(bulkStringMsg, data)
+	}
+	return r.writeBlob(verbatimStringMsg, format+":"+data)
+}
+
+// WriteBlobError write an error in bulk form, like !10\r\nERR failed\r\n,
+// it is a simple error with CR and LF replaced by spaces in RESP2.
+func (r *RespWriter) WriteBlobError(err error) error {
+	if r.version == Resp2 {
+		return r.writeLine(errorMsg, err.Error())
+	}
+	return r.writeBlob(blobErrorMsg, err.Error())
+}
+
+// WriteData write a parsed Data with current protocol version
+func (r *RespWriter) WriteData(data Data) error {
+	switch d := data.(type) {
+	case StatusMsg:
+		return r.WriteStatus(d.status)
+	case ErrorMsg:
+		return r.WriteError(d.err)
+	case IntegerMsg:
+		return r.WriteInteger(d.i)
+	case BulkStringMsg:
+		if d.IsNull() {
+			return r.WriteNull()
+		}
+		return r.WriteBulk(d.data)
+	case ArrayMsg:
+		if d.len < 0 {
+			return r.WriteNullArray()
+		}
+		if err := r.WriteArrayHeader(len(d.arr)); err != nil {
+			return err
+		}
+		return r.writeElements(d.arr)
+	case NullMsg:
+		return r.WriteNull()
+	case DoubleMsg:
+		return r.WriteDouble(d.f)
+	case BooleanMsg:
+		return r.WriteBoolean(d.b)
+	case BigNumberMsg:
+		return r.WriteBigNumber(d.n)
+	case VerbatimStringMsg:
+		return r.WriteVerbatim(d.format, string(d.data))
+	case BlobErrorMsg:
+		return r.WriteBlobError(d.err)
+	case MapMsg:
+		if err := r.WriteMapHeader(len(d.entries)); err != nil {
+			return err
+		}
+		return r.writeEntries(d.entries)
+	case SetMsg:
+		if err := r.WriteSetHeader(len(d.arr)); err != nil {
+			return err
+		}
+		return r.writeElements(d.arr)
+	case PushMsg:
+		if err := r.WritePushHeader(len(d.arr)); err != nil {
+			return err
+		}
+		return r.writeElements(d.arr)
+	case AttributeMsg:
+		// attributes are dropped silently in RESP2, only the reply will be written
+		if r.version == Resp3 {
+			if err := r.WriteAttributeHeader(len(d.entries)); err != nil {
+				return err
+			}
+			if err := r.writeEntries(d.entries); err != nil {
+				return err
+			}
+		}
+		if d.data == nil {
+			return nil
+		}
+		return r.WriteData(d.data)
+	default:
+		_, err := r.w.Write(data.Bytes())
+		return err
+	}
+}
+
+func (r *RespWriter) writeElements(arr []Data) error {
+	for _, elem := range arr {
+		if err := r.WriteData(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RespWriter) writeEntries(entries []MapEntry) error {
+	for _, entry := range entries {
+		if err := r.WriteData(entry.Key); err != nil {
+			return err
+		}
+		if err := r.WriteData(entry.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Buffered returns the number of bytes that have been written into the buffer but not flushed
+func (r *RespWriter) Buffered() int {
+	return r.w.Buffered()
+}
+
+// Flush write the buffered data to the underlying writer
+func (r *RespWriter) Flush() error {
+	return r.w.Flush()
+}
+
+// Reset discards any unflushed data and switch to write to w, the version is reset to RESP2
+func (r *RespWriter) Reset(w io.Writer) {
+	r.w.Reset(w)
+	r.version = Resp2
+}
@@ -0,0 +1,30 @@
+package redis
+
+import (
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/redis/resproto3"
+)
+
+// Session is the redis state of a client
+type Session struct {
+	// index of the selected database
+	db int
+	// protocol version negotiated by HELLO
+	proto resproto3.Version
+}
+
+// Protocol returns the protocol version of the replies
+func (s *Session) Protocol() resproto3.Version {
+	return s.proto
+}
+
+// DB returns the index of the selected database
+func (s *Session) DB() int {
+	return s.db
+}
+
+// DB returns the database selected by the client
+func (r *Request) DB() *database.DB {
+	db, _ := r.Keyspace.DB(r.Session.db)
+	return db
+}
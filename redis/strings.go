@@ -0,0 +1,749 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/redis/resproto3"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStringLen is the max length of string value, the same as proto-max-bulk-len of redis
+const maxStringLen = 512 * 1024 * 1024
+
+var (
+	errOverflow       = errors.New("ERR increment or decrement would overflow")
+	errNotFloat       = errors.New("ERR value is not a valid float")
+	errStringTooLong  = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	errOffsetOutRange = errors.New("ERR offset is out of range")
+	errLCSNotString   = errors.New("ERR The specified keys must contain string values")
+	errLCSLenAndIdx   = errors.New("ERR If you want both the length and indexes, please just use IDX.")
+	errLCSOutOfMemory = errors.New("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	errNaNOrInfinity  = errors.New("ERR increment would produce NaN or Infinity")
+)
+
+// stringCommands returns the commands of string type
+func stringCommands() []*Command {
+	return []*Command{
+		{Name: "get", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: get},
+		{Name: "set", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Func: set},
+		{Name: "setnx", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: setnx},
+		{Name: "setex", Arity: 4, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Func: setex},
+		{Name: "psetex", Arity: 4, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Func: setex},
+		{Name: "getset", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: getset},
+		{Name: "getdel", Arity: 2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: getdel},
+		{Name: "getex", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: getex},
+		{Name: "mget", Arity: -2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Func: mget},
+		{Name: "mset", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 2, Func: mset},
+		{Name: "msetnx", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 2, Func: mset},
+		{Name: "append", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: appendCommand},
+		{Name: "strlen", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: strlen},
+		{Name: "getrange", Arity: 4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Func: getrange},
+		{Name: "setrange", Arity: 4, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Func: setrange},
+		{Name: "incr", Arity: 2, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: incr},
+		{Name: "decr", Arity: 2, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: incr},
+		{Name: "incrby", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: incr},
+		{Name: "decrby", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: incr},
+		{Name: "incrbyfloat", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Func: incrbyfloat},
+		{Name: "lcs", Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 2, Step: 1, Func: lcs},
+	}
+}
+
+// writeString writes the value of string object, or null if it is nil
+func writeString(writer *resproto3.RespWriter, obj *database.Object) error {
+	if obj == nil {
+		return writer.WriteNull()
+	}
+	return writer.WriteBulk(obj.StringBytes())
+}
+
+func invalidExpireError(cmd string) error {
+	return fmt.Errorf("ERR invalid expire time in '%s' command", cmd)
+}
+
+// parseExpireAt converts the argument of EX, PX, EXAT or PXAT option to unix time in milliseconds
+func parseExpireAt(cmd, option string, arg []byte) (int64, error) {
+	n, ok := parseInt(arg)
+	if !ok {
+		return 0, errNotInteger
+	} else if n <= 0 {
+		return 0, invalidExpireError(cmd)
+	}
+
+	if option == "ex" || option == "exat" {
+		if n > math.MaxInt64/1000 {
+			return 0, invalidExpireError(cmd)
+		}
+		n *= 1000
+	}
+	if option == "ex" || option == "px" {
+		now := time.Now().UnixMilli()
+		if n > math.MaxInt64-now {
+			return 0, invalidExpireError(cmd)
+		}
+		n += now
+	}
+	return n, nil
+}
+
+// GET key
+func get(req *Request, writer *resproto3.RespWriter) error {
+	obj, err := req.DB().Lookup(string(req.Args[1]), database.TypeString)
+	if err != nil {
+		return writer.WriteError(err)
+	}
+	return writeString(writer, obj)
+}
+
+// setOptions is the options of SET
+type setOptions struct {
+	nx, xx, get, keepTTL bool
+	// one of ex, px, exat and pxat
+	expire    string
+	expireArg []byte
+}
+
+func parseSetOptions(args [][]byte) (setOptions, error) {
+	var opts setOptions
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "nx" && !opts.xx:
+			opts.nx = true
+		case option == "xx" && !opts.nx:
+			opts.xx = true
+		case option == "get":
+			opts.get = true
+		case option == "keepttl" && opts.expire == "":
+			opts.keepTTL = true
+		case (option == "ex" || option == "px" || option == "exat" || option == "pxat") &&
+			!opts.keepTTL && opts.expire == "" && i+1 < len(args):
+			opts.expire, opts.expireArg = option, args[i+1]
+			i++
+		default:
+			return opts, errSyntax
+		}
+	}
+	return opts, nil
+}
+
+// SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds |
+// PXAT unix-time-milliseconds | KEEPTTL]
+func set(req *Request, writer *resproto3.RespWriter) error {
+	opts, err := parseSetOptions(req.Args[3:])
+	if err != nil {
+		return writer.WriteError(err)
+	}
+
+	var expireAt int64
+	if opts.expire != "" {
+		if expireAt, err = parseExpireAt("set", opts.expire, opts.expireArg); err != nil {
+			return writer.WriteError(err)
+		}
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	old, exists := db.Get(key)
+	if opts.get && exists && old.Type != database.TypeString {
+		db.Unlock(key)
+		return writer.WriteError(database.ErrWrongType)
+	}
+
+	if opts.nx && exists || opts.xx && !exists {
+		db.Unlock(key)
+		if opts.get {
+			return writeString(writer, old)
+		}
+		return writer.WriteNull()
+	}
+
+	obj := database.NewString(req.Args[2])
+	if opts.keepTTL && exists {
+		obj.SetExpireAt(old.ExpireAt())
+	} else {
+		obj.SetExpireAt(expireAt)
+	}
+	db.Set(key, obj)
+	db.Unlock(key)
+
+	if opts.get {
+		return writeString(writer, old)
+	}
+	return writer.WriteStatus("OK")
+}
+
+// SETNX key value
+func setnx(req *Request, writer *resproto3.RespWriter) error {
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	exists := db.Exists(key)
+	if !exists {
+		db.Set(key, database.NewString(req.Args[2]))
+	}
+	db.Unlock(key)
+
+	if exists {
+		return writer.WriteInteger(0)
+	}
+	return writer.WriteInteger(1)
+}
+
+// SETEX key seconds value, PSETEX key milliseconds value
+func setex(req *Request, writer *resproto3.RespWriter) error {
+	option := "ex"
+	if req.Command.Name == "psetex" {
+		option = "px"
+	}
+	expireAt, err := parseExpireAt(req.Command.Name, option, req.Args[2])
+	if err != nil {
+		return writer.WriteError(err)
+	}
+
+	key := string(req.Args[1])
+	obj := database.NewString(req.Args[3])
+	obj.SetExpireAt(expireAt)
+
+	db := req.DB()
+	db.Lock(key)
+	db.Set(key, obj)
+	db.Unlock(key)
+	return writer.WriteStatus("OK")
+}
+
+// GETSET key value
+func getset(req *Request, writer *resproto3.RespWriter) error {
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	old, err := db.Lookup(key, database.TypeString)
+	if err == nil {
+		db.Set(key, database.NewString(req.Args[2]))
+	}
+	db.Unlock(key)
+
+	if err != nil {
+		return writer.WriteError(err)
+	}
+	return writeString(writer, old)
+}
+
+// GETDEL key
+func getdel(req *Request, writer *resproto3.RespWriter) error {
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	obj, err := db.Lookup(key, database.TypeString)
+	if obj != nil {
+		db.Delete(key)
+	}
+	db.Unlock(key)
+
+	if err != nil {
+		return writer.WriteError(err)
+	}
+	return writeString(writer, obj)
+}
+
+// GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func getex(req *Request, writer *resproto3.RespWriter) error {
+	var (
+		option   string
+		expireAt int64
+		err      error
+	)
+	switch args := req.Args[2:]; {
+	case len(args) == 0:
+	case len(args) == 1 && strings.EqualFold(string(args[0]), "persist"):
+		option = "persist"
+	case len(args) == 2:
+		option = strings.ToLower(string(args[0]))
+		if option != "ex" && option != "px" && option != "exat" && option != "pxat" {
+			return writer.WriteError(errSyntax)
+		}
+		if expireAt, err = parseExpireAt("getex", option, args[1]); err != nil {
+			return writer.WriteError(err)
+		}
+	default:
+		return writer.WriteError(errSyntax)
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	obj, err := db.Lookup(key, database.TypeString)
+	if obj != nil && option != "" {
+		// expireAt is 0 for PERSIST
+		obj.SetExpireAt(expireAt)
+	}
+	db.Unlock(key)
+
+	if err != nil {
+		return writer.WriteError(err)
+	}
+	return writeString(writer, obj)
+}
+
+// MGET key [key ...], the keys holding other types are replied as null
+func mget(req *Request, writer *resproto3.RespWriter) error {
+	db := req.DB()
+	objs := make([]*database.Object, len(req.Args)-1)
+	for i, key := range req.Args[1:] {
+		if obj, ok := db.Get(string(key)); ok && obj.Type == database.TypeString {
+			objs[i] = obj
+		}
+	}
+
+	if err := writer.WriteArrayHeader(len(objs)); err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if err := writeString(writer, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MSET key value [key value ...], MSETNX key value [key value ...]
+func mset(req *Request, writer *resproto3.RespWriter) error {
+	if len(req.Args)%2 == 0 {
+		return writer.WriteError(wrongArityError(req.Command.Name))
+	}
+
+	keys := stringArgs(req.Command.Keys(req.Args))
+	nx := req.Command.Name == "msetnx"
+
+	db := req.DB()
+	unlock := db.LockKeys(keys, nil)
+	if nx {
+		for _, key := range keys {
+			if db.Exists(key) {
+				unlock()
+				return writer.WriteInteger(0)
+			}
+		}
+	}
+	for i, key := range keys {
+		db.Set(key, database.NewString(req.Args[2*i+2]))
+	}
+	unlock()
+
+	if nx {
+		return writer.WriteInteger(1)
+	}
+	return writer.WriteStatus("OK")
+}
+
+// APPEND key value
+func appendCommand(req *Request, writer *resproto3.RespWriter) error {
+	key, value := string(req.Args[1]), req.Args[2]
+	db := req.DB()
+	db.Lock(key)
+	defer db.Unlock(key)
+
+	old, err := db.Lookup(key, database.TypeString)
+	if err != nil {
+		return writer.WriteError(err)
+	} else if old == nil {
+		db.Set(key, database.NewString(value))
+		return writer.WriteInteger(int64(len(value)))
+	}
+
+	b := old.StringBytes()
+	if len(b)+len(value) > maxStringLen {
+		return writer.WriteError(errStringTooLong)
+	}
+
+	// copy on write, the spare capacity of old value may be shared with other objects
+	obj := database.NewObject(database.TypeString, append(b[:len(b):len(b)], value...))
+	obj.SetExpireAt(old.ExpireAt())
+	db.Set(key, obj)
+	return writer.WriteInteger(int64(obj.StringLen()))
+}
+
+// STRLEN key
+func strlen(req *Request, writer *resproto3.RespWriter) error {
+	obj, err := req.DB().Lookup(string(req.Args[1]), database.TypeString)
+	if err != nil {
+		return writer.WriteError(err)
+	} else if obj == nil {
+		return writer.WriteInteger(0)
+	}
+	return writer.WriteInteger(int64(obj.StringLen()))
+}
+
+// GETRANGE key start end, the negative offsets count from the end of string
+func getrange(req *Request, writer *resproto3.RespWriter) error {
+	start, ok := parseInt(req.Args[2])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	}
+	end, ok := parseInt(req.Args[3])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	}
+
+	obj, err := req.DB().Lookup(string(req.Args[1]), database.TypeString)
+	if err != nil {
+		return writer.WriteError(err)
+	} else if obj == nil || start < 0 && end < 0 && start > end {
+		return writer.WriteBulkString("")
+	}
+
+	b := obj.StringBytes()
+	n := int64(len(b))
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	start, end = max(start, 0), min(max(end, 0), n-1)
+	if start > end || n == 0 {
+		return writer.WriteBulkString("")
+	}
+	return writer.WriteBulk(b[start : end+1])
+}
+
+// SETRANGE key offset value, the string is padded with zero bytes if it is shorter than offset
+func setrange(req *Request, writer *resproto3.RespWriter) error {
+	offset, ok := parseInt(req.Args[2])
+	if !ok {
+		return writer.WriteError(errNotInteger)
+	} else if offset < 0 {
+		return writer.WriteError(errOffsetOutRange)
+	}
+
+	key, value := string(req.Args[1]), req.Args[3]
+	db := req.DB()
+	db.Lock(key)
+	defer db.Unlock(key)
+
+	old, err := db.Lookup(key, database.TypeString)
+	if err != nil {
+		return writer.WriteError(err)
+	}
+
+	var b []byte
+	if old != nil {
+		b = old.StringBytes()
+	}
+	if len(value) == 0 {
+		return writer.WriteInteger(int64(len(b)))
+	} else if offset+int64(len(value)) > maxStringLen {
+		return writer.WriteError(errStringTooLong)
+	}
+
+	// copy on write, the old value may be being read
+	updated := make([]byte, max(len(b), int(offset)+len(value)))
+	copy(updated, b)
+	copy(updated[offset:], value)
+
+	obj := database.NewObject(database.TypeString, updated)
+	if old != nil {
+		obj.SetExpireAt(old.ExpireAt())
+	}
+	db.Set(key, obj)
+	return writer.WriteInteger(int64(len(updated)))
+}
+
+// INCR key, DECR key, INCRBY key increment, DECRBY key decrement
+func incr(req *Request, writer *resproto3.RespWriter) error {
+	delta := int64(1)
+	switch req.Command.Name {
+	case "decr":
+		delta = -1
+	case "incrby", "decrby":
+		n, ok := parseInt(req.Args[2])
+		if !ok {
+			return writer.WriteError(errNotInteger)
+		}
+		delta = n
+		if req.Command.Name == "decrby" {
+			if n == math.MinInt64 {
+				return writer.WriteError(errors.New("ERR decrement would overflow"))
+			}
+			delta = -n
+		}
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	defer db.Unlock(key)
+
+	old, err := db.Lookup(key, database.TypeString)
+	if err != nil {
+		return writer.WriteError(err)
+	}
+
+	var current int64
+	if old != nil {
+		n, ok := old.StringInt()
+		if !ok {
+			if n, ok = parseInt(old.StringBytes()); !ok {
+				return writer.WriteError(errNotInteger)
+			}
+		}
+		current = n
+	}
+
+	if delta < 0 && current < 0 && delta < math.MinInt64-current ||
+		delta > 0 && current > 0 && delta > math.MaxInt64-current {
+		return writer.WriteError(errOverflow)
+	}
+
+	obj := database.NewInteger(current + delta)
+	if old != nil {
+		obj.SetExpireAt(old.ExpireAt())
+	}
+	db.Set(key, obj)
+	return writer.WriteInteger(current + delta)
+}
+
+// longDoublePrec is the mantissa bits of x87 long double, redis computes INCRBYFLOAT in long double
+const longDoublePrec = 64
+
+// maxLongDoubleChars is the max length of a float argument, the same as MAX_LONG_DOUBLE_CHARS of redis
+const maxLongDoubleChars = 5 * 1024
+
+// parseFloat parses the float without spaces as strtold does, NaN is not allowed,
+// the result is rounded to the precision of long double.
+func parseFloat(b []byte) (*big.Float, bool) {
+	if len(b) >= maxLongDoubleChars || bytes.IndexByte(b, '_') >= 0 {
+		return nil, false
+	}
+	// the syntax and the range are checked by ParseFloat before parsing the exact value
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsNaN(f) {
+		return nil, false
+	} else if math.IsInf(f, 0) {
+		return new(big.Float).SetInf(f < 0), true
+	} else if f == 0 {
+		// the underflowed value is formatted as zero anyway, so its huge negative exponent is never expanded
+		return new(big.Float).SetPrec(longDoublePrec), true
+	}
+	r, ok := new(big.Rat).SetString(string(b))
+	if !ok {
+		return nil, false
+	}
+	return new(big.Float).SetPrec(longDoublePrec).SetRat(r), true
+}
+
+// formatFloat formats the float as ld2string of redis in human mode, it is "%.17Lf" without the trailing zeros
+func formatFloat(f *big.Float) []byte {
+	value := f.Append(nil, 'f', 17)
+	value = bytes.TrimRight(value, "0")
+	value = bytes.TrimSuffix(value, []byte("."))
+	if string(value) == "-0" {
+		value = value[1:]
+	}
+	return value
+}
+
+// INCRBYFLOAT key increment
+func incrbyfloat(req *Request, writer *resproto3.RespWriter) error {
+	delta, ok := parseFloat(req.Args[2])
+	if !ok {
+		return writer.WriteError(errNotFloat)
+	}
+
+	key := string(req.Args[1])
+	db := req.DB()
+	db.Lock(key)
+	defer db.Unlock(key)
+
+	old, err := db.Lookup(key, database.TypeString)
+	if err != nil {
+		return writer.WriteError(err)
+	}
+
+	current := new(big.Float)
+	if old != nil {
+		if current, ok = parseFloat(old.StringBytes()); !ok {
+			return writer.WriteError(errNotFloat)
+		}
+	}
+
+	if current.IsInf() || delta.IsInf() {
+		return writer.WriteError(errNaNOrInfinity)
+	}
+	result := new(big.Float).SetPrec(longDoublePrec).Add(current, delta)
+	// the result out of the range of float64 could not be parsed again, so it is treated as infinity
+	if f, _ := result.Float64(); math.IsInf(f, 0) {
+		return writer.WriteError(errNaNOrInfinity)
+	}
+
+	value := formatFloat(result)
+	obj := database.NewString(value)
+	if old != nil {
+		obj.SetExpireAt(old.ExpireAt())
+	}
+	db.Set(key, obj)
+	return writer.WriteBulk(value)
+}
+
+// lcsMatch is a matched range of LCS IDX reply
+type lcsMatch struct {
+	aStart, aEnd, bStart, bEnd int
+}
+
+// LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN]
+func lcs(req *Request, writer *resproto3.RespWriter) error {
+	db := req.DB()
+	objA, errA := db.Lookup(string(req.Args[1]), database.TypeString)
+	objB, errB := db.Lookup(string(req.Args[2]), database.TypeString)
+	if errA != nil || errB != nil {
+		return writer.WriteError(errLCSNotString)
+	}
+
+	var (
+		getLen, getIdx, withMatchLen bool
+		minMatchLen                  int64
+	)
+	for i := 3; i < len(req.Args); i++ {
+		switch option := strings.ToLower(string(req.Args[i])); {
+		case option == "idx":
+			getIdx = true
+		case option == "len":
+			getLen = true
+		case option == "withmatchlen":
+			withMatchLen = true
+		case option == "minmatchlen" && i+1 < len(req.Args):
+			n, ok := parseInt(req.Args[i+1])
+			if !ok {
+				return writer.WriteError(errNotInteger)
+			}
+			minMatchLen = max(n, 0)
+			i++
+		default:
+			return writer.WriteError(errSyntax)
+		}
+	}
+	if getIdx && getLen {
+		return writer.WriteError(errLCSLenAndIdx)
+	}
+
+	var a, b []byte
+	if objA != nil {
+		a = objA.StringBytes()
+	}
+	if objB != nil {
+		b = objB.StringBytes()
+	}
+	if (int64(len(a))+1)*(int64(len(b))+1)*4 > maxStringLen {
+		return writer.WriteError(errLCSOutOfMemory)
+	}
+
+	// table[i*(len(b)+1)+j] is the length of LCS of a[:i] and b[:j]
+	width := len(b) + 1
+	table := make([]uint32, (len(a)+1)*width)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				table[i*width+j] = table[(i-1)*width+j-1] + 1
+			} else {
+				table[i*width+j] = max(table[(i-1)*width+j], table[i*width+j-1])
+			}
+		}
+	}
+	length := int(table[len(a)*width+len(b)])
+
+	if getLen {
+		return writer.WriteInteger(int64(length))
+	}
+
+	// walk back from the end to build the LCS and the matched ranges, in the same order as redis
+	result := make([]byte, length)
+	var matches []lcsMatch
+	idx, i, j := length, len(a), len(b)
+	current, inRange := lcsMatch{}, false
+	for i > 0 && j > 0 {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if !inRange {
+				current, inRange = lcsMatch{aStart: i - 1, aEnd: i - 1, bStart: j - 1, bEnd: j - 1}, true
+			} else if current.aStart == i && current.bStart == j {
+				current.aStart--
+				current.bStart--
+			} else {
+				emit = true
+			}
+			if current.aStart == 0 || current.bStart == 0 {
+				emit = true
+			}
+			idx, i, j = idx-1, i-1, j-1
+		} else {
+			if table[(i-1)*width+j] > table[i*width+j-1] {
+				i--
+			} else {
+				j--
+			}
+			emit = inRange
+		}
+
+		if emit {
+			if int64(current.aEnd-current.aStart+1) >= minMatchLen {
+				matches = append(matches, current)
+			}
+			inRange = false
+		}
+	}
+
+	if !getIdx {
+		return writer.WriteBulk(result)
+	}
+
+	// matches, the ranges, len, the length of LCS, it is a flat array in RESP2
+	if err := writer.WriteMapHeader(2); err != nil {
+		return err
+	}
+	if err := writer.WriteBulkString("matches"); err != nil {
+		return err
+	}
+	if err := writer.WriteArrayHeader(len(matches)); err != nil {
+		return err
+	}
+	for _, m := range matches {
+		if err := writeLCSMatch(writer, m, withMatchLen); err != nil {
+			return err
+		}
+	}
+	if err := writer.WriteBulkString("len"); err != nil {
+		return err
+	}
+	return writer.WriteInteger(int64(length))
+}
+
+func writeLCSMatch(writer *resproto3.RespWriter, m lcsMatch, withMatchLen bool) error {
+	n := 2
+	if withMatchLen {
+		n++
+	}
+	if err := writer.WriteArrayHeader(n); err != nil {
+		return err
+	}
+	for _, r := range [][2]int{{m.aStart, m.aEnd}, {m.bStart, m.bEnd}} {
+		if err := writer.WriteArrayHeader(2); err != nil {
+			return err
+		}
+		if err := writer.WriteInteger(int64(r[0])); err != nil {
+			return err
+		}
+		if err := writer.WriteInteger(int64(r[1])); err != nil {
+			return err
+		}
+	}
+	if withMatchLen {
+		return writer.WriteInteger(int64(m.aEnd - m.aStart + 1))
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/246859/codis/coco"
+	"github.com/246859/codis/redis"
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/redis/resproto2"
+	"github.com/246859/codis/redis/resproto3"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func noop(req *redis.Request, writer *resproto3.RespWriter) error {
+	return writer.WriteStatus("OK")
+}
+
+func TestRegistry(t *testing.T) {
+	registry := redis.NewRegistry()
+	if err := registry.Register(&redis.Command{Name: "MSET", Arity: -3, Flags: redis.FlagWrite | redis.FlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 2, Func: noop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(&redis.Command{Name: "mset", Arity: -3, Func: noop}); !errors.Is(err, redis.ErrCommandExists) {
+		t.Fatalf("expected ErrCommandExists, got %v", err)
+	}
+	if err := registry.Register(&redis.Command{Name: "get", Arity: 0, Func: noop}); !errors.Is(err, redis.ErrInvalidCommand) {
+		t.Fatalf("expected ErrInvalidCommand, got %v", err)
+	}
+
+	cmd, ok := registry.Lookup([]byte("mSeT"))
+	if !ok || cmd.Name != "mset" {
+		t.Fatalf("expected mset found case-insensitively, got %v %v", cmd, ok)
+	}
+	if _, ok := registry.Lookup([]byte(strings.Repeat("a", 100))); ok {
+		t.Fatal("expected long name not found")
+	}
+
+	if cmd.CheckArity(2) || !cmd.CheckArity(3) || !cmd.CheckArity(5) {
+		t.Error("expected arity -3 means at least 3 arguments")
+	}
+	if !cmd.HasFlag(redis.FlagWrite) || cmd.HasFlag(redis.FlagReadonly) {
+		t.Error("unexpected flags")
+	}
+	if names := cmd.Flags.Names(); strings.Join(names, ",") != "write,denyoom" {
+		t.Errorf("unexpected flag names %v", names)
+	}
+
+	args := [][]byte{[]byte("mset"), []byte("k1"), []byte("v1"), []byte("k2"), []byte("v2")}
+	keys := cmd.Keys(args)
+	if len(keys) != 2 || string(keys[0]) != "k1" || string(keys[1]) != "k2" {
+		t.Errorf("unexpected keys %q", keys)
+	}
+}
+
+// serveRedis serves the registry and keyspace on a random port and returns a connected client
+func serveRedis(t *testing.T, registry *redis.Registry, keyspace *database.Keyspace) net.Conn {
+	server := coco.NewServer(context.Background(), coco.WithCloseTimeout(time.Second))
+	addr, err := server.ListenAndServe("tcp", "127.0.0.1:0", redis.NewHandler(resproto2.DefaultLimits, registry, keyspace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Shutdown() })
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// expectReplies sends the requests and checks the raw replies
+func expectReplies(t *testing.T, conn net.Conn, reader *bufio.Reader, requests string, replies string) {
+	t.Helper()
+	if _, err := conn.Write([]byte(requests)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(replies))
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Fatalf("read %q: %v", buf, err)
+	}
+	if string(buf) != replies {
+		t.Fatalf("expected %q, got %q", replies, buf)
+	}
+}
+
+func TestHandler_Dispatch(t *testing.T) {
+	registry := redis.DefaultRegistry()
+	conn := serveRedis(t, registry, nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "PING\r\nping hello\r\n*2\r\n$4\r\nEcHo\r\n$2\r\nhi\r\n",
+		"+PONG\r\n$5\r\nhello\r\n$2\r\nhi\r\n")
+	expectReplies(t, conn, reader, "echo\r\necho a b\r\nping a b\r\n",
+		"-ERR wrong number of arguments for 'echo' command\r\n"+
+			"-ERR wrong number of arguments for 'echo' command\r\n"+
+			"-ERR wrong number of arguments for 'ping' command\r\n")
+	expectReplies(t, conn, reader, "foo a b\r\nbar\r\n",
+		"-ERR unknown command 'foo', with args beginning with: 'a' 'b' \r\n"+
+			"-ERR unknown command 'bar', with args beginning with: \r\n")
+	expectReplies(t, conn, reader, "command count\r\ncommand info echo nope\r\ncommand foo\r\n",
+		fmt.Sprintf(":%d\r\n", registry.Len())+"*2\r\n*6\r\n$4\r\necho\r\n:2\r\n*1\r\n+fast\r\n:0\r\n:0\r\n:0\r\n*-1\r\n"+
+			"-ERR unknown subcommand 'foo'. Try COMMAND HELP.\r\n")
+	expectReplies(t, conn, reader, "quit\r\n", "+OK\r\n")
+
+	if _, err := reader.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected connection closed after quit, got %v", err)
+	}
+}
+
+// idRegistry returns the default registry with MYID command which replies the client id
+func idRegistry() *redis.Registry {
+	registry := redis.DefaultRegistry()
+	registry.Register(&redis.Command{Name: "myid", Arity: 1, Func: func(req *redis.Request, writer *resproto3.RespWriter) error {
+		return writer.WriteInteger(int64(req.Client.ID()))
+	}})
+	return registry
+}
+
+// clientID returns the client id with the trailing CRLF by MYID command
+func clientID(t *testing.T, conn net.Conn, reader *bufio.Reader) string {
+	expectReplies(t, conn, reader, "myid\r\n", ":")
+	id, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// helloReply returns the fields of HELLO reply without the map or array header
+func helloReply(proto int, id string) string {
+	return fmt.Sprintf("$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n7.0.0\r\n$5\r\nproto\r\n:%d\r\n"+
+		"$2\r\nid\r\n:%s$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n", proto, id)
+}
+
+func TestHandler_Hello(t *testing.T) {
+	registry := idRegistry()
+	conn := serveRedis(t, registry, nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "hello 4\r\nhello x\r\nhello 3 foo\r\nhello 3 auth bob pass\r\nhello 3 setname\r\n",
+		"-NOPROTO unsupported protocol version\r\n-ERR Protocol version is not an integer or out of range\r\n"+
+			"-ERR Syntax error in HELLO option 'foo'\r\n-WRONGPASS invalid username-password pair or user is disabled.\r\n"+
+			"-ERR Syntax error in HELLO option 'setname'\r\n")
+	expectReplies(t, conn, reader, "*4\r\n$5\r\nhello\r\n$1\r\n3\r\n$7\r\nsetname\r\n$3\r\na b\r\nget nope\r\n",
+		"-ERR Client names cannot contain spaces, newlines or special characters.\r\n$-1\r\n")
+
+	id := clientID(t, conn, reader)
+
+	// the reply of HELLO 3 itself is in RESP3
+	expectReplies(t, conn, reader, "hello 3 auth default pass setname conn\r\n", "%7\r\n"+helloReply(3, id))
+	expectReplies(t, conn, reader, "get nope\r\nlpop nope 1\r\nset k1 ohmytext\r\nset k2 mynewtext\r\nlcs k1 k2 idx minmatchlen 4\r\n",
+		"_\r\n_\r\n+OK\r\n+OK\r\n%2\r\n$7\r\nmatches\r\n*1\r\n*2\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n$3\r\nlen\r\n:6\r\n")
+	expectReplies(t, conn, reader, "hello\r\n", "%7\r\n"+helloReply(3, id))
+
+	expectReplies(t, conn, reader, "hello 2\r\nget nope\r\nlpop nope 1\r\n", "*14\r\n"+helloReply(2, id)+"$-1\r\n*-1\r\n")
+}
+
+func TestHandler_Events(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("event-loop mode is only supported on linux")
+	}
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := coco.NewServer(context.Background(), coco.WithEventLoops(1), coco.WithCloseTimeout(time.Second))
+	defer server.Shutdown()
+	if err := server.AddEvents([]net.Listener{listen}, redis.NewHandler(resproto2.DefaultLimits, idRegistry(), nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "PING\r\nset k v\r\n*2\r\n$3\r\nget\r\n$1\r\nk\r\nget nope\r\n",
+		"+PONG\r\n+OK\r\n$1\r\nv\r\n$-1\r\n")
+
+	// the request split into pieces is executed after the last piece arrives
+	for _, piece := range []string{"*3\r\n$3\r\nse", "t\r\n$1\r\nk\r\n$5\r\nhel", "lo\r"} {
+		if _, err := conn.Write([]byte(piece)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectReplies(t, conn, reader, "\n", "+OK\r\n")
+	id := clientID(t, conn, reader)
+	expectReplies(t, conn, reader, "hello 3 setname ev\r\nget nope\r\nget k\r\n", "%7\r\n"+helloReply(3, id)+"_\r\n$5\r\nhello\r\n")
+
+	expectReplies(t, conn, reader, "*1\r\n:1\r\n", "-ERR Protocol error: expected '$', got ':'\r\n")
+	if _, err := reader.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected connection closed after protocol error, got %v", err)
+	}
+
+	conn, err = net.Dial("tcp", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader = bufio.NewReader(conn)
+	expectReplies(t, conn, reader, "get k\r\nquit\r\nget k\r\n", "$5\r\nhello\r\n+OK\r\n")
+	if _, err := reader.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected connection closed after quit, got %v", err)
+	}
+}
+
+func TestHandler_Middleware(t *testing.T) {
+	registry := redis.DefaultRegistry()
+	registry.Register(&redis.Command{Name: "set", Arity: 3, Flags: redis.FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Func: noop})
+
+	var keys []string
+	registry.Use(func(next redis.CommandFunc) redis.CommandFunc {
+		return func(req *redis.Request, writer *resproto3.RespWriter) error {
+			if req.Command.HasFlag(redis.FlagWrite) && string(req.Args[2]) == "readonly" {
+				return writer.WriteError(errors.New("READONLY You can't write against a read only replica."))
+			}
+			for _, key := range req.Command.Keys(req.Args) {
+				keys = append(keys, string(key))
+			}
+			return next(req, writer)
+		}
+	})
+
+	conn := serveRedis(t, registry, nil)
+	reader := bufio.NewReader(conn)
+	expectReplies(t, conn, reader, "set a 1\r\nset b readonly\r\nset c\r\nping\r\n",
+		"+OK\r\n-READONLY You can't write against a read only replica.\r\n"+
+			"-ERR wrong number of arguments for 'set' command\r\n+PONG\r\n")
+
+	if strings.Join(keys, ",") != "a" {
+		t.Errorf("expected keys of the executed commands, got %v", keys)
+	}
+}
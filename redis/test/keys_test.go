@@ -0,0 +1,134 @@
+package test
+
+import (
+	"bufio"
+	"github.com/246859/codis/redis"
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/redis/datastruct/list"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newKeyspace returns a keyspace whose database 0 holds the keys
+func newKeyspace(t *testing.T, objects map[string]*database.Object) *database.Keyspace {
+	keyspace := database.NewKeyspace(database.DefaultDatabases)
+	db, err := keyspace.DB(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, obj := range objects {
+		db.Set(key, obj)
+	}
+	return keyspace
+}
+
+func TestKeys_Generic(t *testing.T) {
+	keyspace := newKeyspace(t, map[string]*database.Object{
+		"a":    database.NewObject(database.TypeString, []byte("1")),
+		"b":    database.NewObject(database.TypeString, []byte("2")),
+		"list": database.NewObject(database.TypeList, list.New()),
+	})
+	conn := serveRedis(t, redis.DefaultRegistry(), keyspace)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "exists a a nope\r\ntype list\r\ntype a\r\ntype nope\r\ndbsize\r\n",
+		":2\r\n+list\r\n+string\r\n+none\r\n:3\r\n")
+	expectReplies(t, conn, reader, "rename a c\r\nrename a c\r\nrenamenx c b\r\nrenamenx c d\r\nexists a c d\r\n",
+		"+OK\r\n-ERR no such key\r\n:0\r\n:1\r\n:1\r\n")
+	expectReplies(t, conn, reader, "keys [lb]*\r\n", "*2\r\n")
+	keys := []string{readBulk(t, reader), readBulk(t, reader)}
+	sort.Strings(keys)
+	if keys[0] != "b" || keys[1] != "list" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	expectReplies(t, conn, reader, "del b d nope\r\ndbsize\r\nrandomkey\r\nflushdb\r\nrandomkey\r\nflushdb now\r\n",
+		":2\r\n:1\r\n$4\r\nlist\r\n+OK\r\n$-1\r\n-ERR syntax error\r\n")
+}
+
+func TestKeys_Databases(t *testing.T) {
+	keyspace := newKeyspace(t, map[string]*database.Object{
+		"a": database.NewObject(database.TypeString, []byte("1")),
+		"b": database.NewObject(database.TypeString, []byte("2")),
+	})
+	conn := serveRedis(t, redis.DefaultRegistry(), keyspace)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "select 16\r\nselect x\r\nselect 01\r\nmove a 0\r\nmove a x\r\nmove a 99\r\n",
+		"-ERR DB index is out of range\r\n-ERR value is not an integer or out of range\r\n"+
+			"-ERR value is not an integer or out of range\r\n"+
+			"-ERR source and destination objects are the same\r\n"+
+			"-ERR value is not an integer or out of range\r\n-ERR DB index is out of range\r\n")
+	expectReplies(t, conn, reader, "move a 1\r\nmove a 1\r\nselect 1\r\nexists a b\r\n",
+		":1\r\n:0\r\n+OK\r\n:1\r\n")
+
+	// db 0 holds b, db 1 holds a
+	expectReplies(t, conn, reader, "swapdb 0 1\r\nexists a b\r\nswapdb x 1\r\nswapdb 0 x\r\nswapdb 0 16\r\n",
+		"+OK\r\n:1\r\n-ERR invalid first DB index\r\n-ERR invalid second DB index\r\n-ERR DB index is out of range\r\n")
+	expectReplies(t, conn, reader, "type b\r\nflushall\r\ndbsize\r\nselect 0\r\ndbsize\r\n",
+		"+string\r\n+OK\r\n:0\r\n+OK\r\n:0\r\n")
+}
+
+func TestDB_Lookup(t *testing.T) {
+	keyspace := newKeyspace(t, map[string]*database.Object{
+		"a": database.NewObject(database.TypeString, []byte("1")),
+	})
+	db, _ := keyspace.DB(0)
+
+	if obj, err := db.Lookup("a", database.TypeString); err != nil || obj == nil {
+		t.Errorf("expected string found, got %v %v", obj, err)
+	}
+	if obj, err := db.Lookup("nope", database.TypeString); err != nil || obj != nil {
+		t.Errorf("expected nil for the missing key, got %v %v", obj, err)
+	}
+	if _, err := db.Lookup("a", database.TypeList); err != database.ErrWrongType {
+		t.Errorf("expected ErrWrongType, got %v", err)
+	}
+	if _, err := keyspace.DB(16); err != database.ErrDBIndexOutOfRange {
+		t.Errorf("expected ErrDBIndexOutOfRange, got %v", err)
+	}
+}
+
+func TestDB_FlushLocksKeys(t *testing.T) {
+	keyspace := newKeyspace(t, map[string]*database.Object{
+		"a": database.NewObject(database.TypeString, []byte("1")),
+	})
+	db, _ := keyspace.DB(0)
+
+	for _, flush := range []func(){db.Flush, keyspace.FlushAll} {
+		// a command modifying the key in multiple steps is not interleaved with the flush
+		db.Lock("a")
+		done := make(chan struct{})
+		go func() {
+			flush()
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("expected the flush waits for the key lock")
+		case <-time.After(50 * time.Millisecond):
+		}
+		db.Set("a", database.NewObject(database.TypeString, []byte("2")))
+		db.Unlock("a")
+
+		<-done
+		if db.Exists("a") {
+			t.Error("expected the key written before the flush removed")
+		}
+		db.Set("a", database.NewObject(database.TypeString, []byte("1")))
+	}
+}
+
+func readBulk(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	header, err := reader.ReadString('\n')
+	if err != nil || header[0] != '$' {
+		t.Fatalf("expected bulk, got %q %v", header, err)
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line[:len(line)-2]
+}
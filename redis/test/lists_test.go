@@ -0,0 +1,126 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/246859/codis/redis"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bulks formats the values as an array reply of bulk strings
+func bulks(values ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(values))
+	for _, v := range values {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(v), v)
+	}
+	return b.String()
+}
+
+func TestLists_PushPop(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "rpush l a b c\r\nlpush l x y\r\nlrange l 0 -1\r\nllen l\r\nlpushx nope a\r\nrpushx l z\r\nexists nope\r\n",
+		":3\r\n:5\r\n"+bulks("y", "x", "a", "b", "c")+":5\r\n:0\r\n:6\r\n:0\r\n")
+	expectReplies(t, conn, reader, "lpop l\r\nrpop l 2\r\nlpop l 0\r\nlpop l -1\r\nlpop l 1 2\r\nlpop nope\r\nlpop nope 1\r\n",
+		"$1\r\ny\r\n"+bulks("z", "c")+"*0\r\n-ERR value is out of range, must be positive\r\n"+
+			"-ERR wrong number of arguments for 'lpop' command\r\n$-1\r\n*-1\r\n")
+	expectReplies(t, conn, reader, "rpop l 10\r\nexists l\r\nllen l\r\n", bulks("b", "a", "x")+":0\r\n:0\r\n")
+
+	// wrong type
+	wrongType := "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	expectReplies(t, conn, reader, "set s 1\r\nlpush s a\r\nrpushx s a\r\nlpop s\r\nllen s\r\nlrange s 0 -1\r\n",
+		"+OK\r\n"+strings.Repeat(wrongType, 5))
+}
+
+func TestLists_Index(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "rpush l a b c d e\r\nlindex l 0\r\nlindex l -1\r\nlindex l 5\r\nlindex l x\r\n",
+		":5\r\n$1\r\na\r\n$1\r\ne\r\n$-1\r\n-ERR value is not an integer or out of range\r\n")
+	expectReplies(t, conn, reader, "lset l 1 B\r\nlset l 5 x\r\nlset nope 0 x\r\nlrange l 1 -2\r\nlrange l 3 1\r\nlrange l -100 100\r\nlrange nope 0 -1\r\n",
+		"+OK\r\n-ERR index out of range\r\n-ERR no such key\r\n"+bulks("B", "c", "d")+"*0\r\n"+bulks("a", "B", "c", "d", "e")+"*0\r\n")
+	expectReplies(t, conn, reader, "linsert l before c X\r\nlinsert l after nope Y\r\nlinsert nope before a b\r\nlinsert l middle a b\r\nlrange l 0 -1\r\n",
+		":6\r\n:-1\r\n:0\r\n-ERR syntax error\r\n"+bulks("a", "B", "X", "c", "d", "e"))
+
+	expectReplies(t, conn, reader, "rpush r a b a c a\r\nlrem r -2 a\r\nlrange r 0 -1\r\nlrem r 0 a\r\nltrim r 1 -1\r\nlrange r 0 -1\r\nltrim r 5 10\r\nexists r\r\n",
+		":5\r\n:2\r\n"+bulks("a", "b", "c")+":1\r\n+OK\r\n"+bulks("c")+"+OK\r\n:0\r\n")
+}
+
+func TestLists_Pos(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "rpush p a b c 1 2 3 c c\r\nlpos p c\r\nlpos p c rank 2\r\nlpos p c rank -1\r\nlpos p c count 0\r\nlpos p c count 2 rank -1\r\n",
+		":8\r\n:2\r\n:6\r\n:7\r\n*3\r\n:2\r\n:6\r\n:7\r\n*2\r\n:7\r\n:6\r\n")
+	expectReplies(t, conn, reader, "lpos p c maxlen 2\r\nlpos p c count 0 maxlen 3\r\nlpos p c rank -2 maxlen 2\r\nlpos p nope\r\nlpos nope c count 1\r\n",
+		"$-1\r\n*1\r\n:2\r\n:6\r\n$-1\r\n*0\r\n")
+	expectReplies(t, conn, reader, "lpos p c rank 0\r\nlpos p c count -1\r\nlpos p c maxlen x\r\nlpos p c rank -9223372036854775808\r\nlpos p c foo\r\nlpos p c rank\r\n",
+		"-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n"+
+			"-ERR COUNT can't be negative\r\n-ERR MAXLEN can't be negative\r\n"+
+			"-ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807\r\n"+
+			"-ERR syntax error\r\n-ERR syntax error\r\n")
+}
+
+func TestLists_Move(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "rpush s a b c\r\nlmove s d right left\r\nlmove s d left right\r\nlrange d 0 -1\r\nrpoplpush s d\r\nexists s\r\nlrange d 0 -1\r\n",
+		":3\r\n$1\r\nc\r\n$1\r\na\r\n"+bulks("c", "a")+"$1\r\nb\r\n:0\r\n"+bulks("b", "c", "a"))
+	expectReplies(t, conn, reader, "lmove d d left right\r\nlrange d 0 -1\r\nlmove nope d left left\r\nlmove d x up left\r\n",
+		"$1\r\nb\r\n"+bulks("c", "a", "b")+"$-1\r\n-ERR syntax error\r\n")
+
+	wrongType := "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	expectReplies(t, conn, reader, "set str 1\r\nlmove d str left left\r\nlmove str d left left\r\nrpoplpush d str\r\nlrange d 0 -1\r\n",
+		"+OK\r\n"+wrongType+wrongType+wrongType+bulks("c", "a", "b"))
+}
+
+func TestLists_Large(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	// spans many nodes
+	var requests, replies strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&requests, "rpush big %d\r\n", i)
+		fmt.Fprintf(&replies, ":%d\r\n", i+1)
+	}
+	expectReplies(t, conn, reader, requests.String(), replies.String())
+
+	expectReplies(t, conn, reader, "lrange big 2498 2501\r\nlindex big -1\r\nltrim big 1000 -1001\r\nllen big\r\nlpos big 3999\r\nlpos big 2000\r\n",
+		bulks("2498", "2499", "2500", "2501")+"$4\r\n4999\r\n+OK\r\n:3000\r\n:2999\r\n:1000\r\n")
+}
+
+func TestLists_SlowReader(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	value := strings.Repeat("v", 64*1024)
+	var requests strings.Builder
+	fmt.Fprintf(&requests, "*66\r\n$5\r\nrpush\r\n$3\r\nbig\r\n")
+	for i := 0; i < 64; i++ {
+		fmt.Fprintf(&requests, "$%d\r\n%s\r\n", len(value), value)
+	}
+	expectReplies(t, conn, reader, requests.String(), ":64\r\n")
+
+	// the replies are far larger than the socket buffers, and they are never read
+	if _, err := conn.Write([]byte(strings.Repeat("lrange big 0 -1\r\nlindex big 0\r\n", 8))); err != nil {
+		t.Fatal(err)
+	}
+	// waits for the server blocking in writing the replies
+	time.Sleep(100 * time.Millisecond)
+
+	writer, err := net.Dial("tcp", conn.RemoteAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	writer.SetDeadline(time.Now().Add(2 * time.Second))
+	expectReplies(t, writer, bufio.NewReader(writer), "rpush big x\r\nllen big\r\n", ":65\r\n:65\r\n")
+}
@@ -0,0 +1,146 @@
+package test
+
+import (
+	"bufio"
+	"github.com/246859/codis/redis"
+	"github.com/246859/codis/redis/database"
+	"github.com/246859/codis/redis/datastruct/list"
+	"testing"
+	"time"
+)
+
+func TestStrings_Set(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "set a 1\r\nget a\r\nget nope\r\nset a 2 nx\r\nset b 2 xx\r\nset a 2 xx get\r\nget a\r\n",
+		"+OK\r\n$1\r\n1\r\n$-1\r\n$-1\r\n$-1\r\n$1\r\n1\r\n$1\r\n2\r\n")
+	expectReplies(t, conn, reader, "set a 1 nx xx\r\nset a 1 ex 10 px 10\r\nset a 1 ex\r\nset a 1 keepttl ex 1\r\nset a 1 ex x\r\nset a 1 ex 0\r\nset a 1 foo\r\n",
+		"-ERR syntax error\r\n-ERR syntax error\r\n-ERR syntax error\r\n-ERR syntax error\r\n"+
+			"-ERR value is not an integer or out of range\r\n-ERR invalid expire time in 'set' command\r\n-ERR syntax error\r\n")
+	expectReplies(t, conn, reader, "setnx a 3\r\nsetnx c 3\r\ngetset c 4\r\ngetset d 5\r\ngetdel d\r\nexists d\r\n",
+		":0\r\n:1\r\n$1\r\n3\r\n$-1\r\n$1\r\n5\r\n:0\r\n")
+	expectReplies(t, conn, reader, "mset x 1 y 2\r\nmset x 1 y\r\nmsetnx y 3 z 3\r\nmsetnx z 3 w 4\r\nmget x y z w nope\r\n",
+		"+OK\r\n-ERR wrong number of arguments for 'mset' command\r\n:0\r\n:1\r\n*5\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n$1\r\n4\r\n$-1\r\n")
+
+	// wrong type
+	keyspace := newKeyspace(t, map[string]*database.Object{"list": database.NewObject(database.TypeList, list.New())})
+	conn = serveRedis(t, redis.DefaultRegistry(), keyspace)
+	reader = bufio.NewReader(conn)
+	wrongType := "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	expectReplies(t, conn, reader, "get list\r\nset list 1 get\r\nincr list\r\nappend list a\r\nmget list\r\nset list 1\r\nget list\r\n",
+		wrongType+wrongType+wrongType+wrongType+"*1\r\n$-1\r\n+OK\r\n$1\r\n1\r\n")
+}
+
+func TestStrings_Expire(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "set a 1 px 50\r\nset b 1 px 50\r\nset b 2 keepttl\r\npsetex c 50 1\r\nsetex d 100 1\r\nset e 1 px 50\r\ngetex e persist\r\n",
+		"+OK\r\n+OK\r\n+OK\r\n+OK\r\n+OK\r\n+OK\r\n$1\r\n1\r\n")
+	expectReplies(t, conn, reader, "setex d 0 1\r\npsetex d x 1\r\ngetex d px\r\ngetex d foo 1\r\ngetex nope ex 10\r\n",
+		"-ERR invalid expire time in 'setex' command\r\n-ERR value is not an integer or out of range\r\n"+
+			"-ERR syntax error\r\n-ERR syntax error\r\n$-1\r\n")
+	expectReplies(t, conn, reader, "getex d pxat 1\r\n", "$1\r\n1\r\n")
+
+	time.Sleep(100 * time.Millisecond)
+	expectReplies(t, conn, reader, "exists a b c d e\r\nkeys *\r\nget b\r\nset a 1 exat 1\r\nget a\r\n",
+		":1\r\n*1\r\n$1\r\ne\r\n$-1\r\n+OK\r\n$-1\r\n")
+}
+
+func TestStrings_Range(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "set s \"This is a string\"\r\ngetrange s 0 3\r\ngetrange s -3 -1\r\ngetrange s 0 -1\r\ngetrange s 10 100\r\ngetrange s 5 3\r\ngetrange s -1 -5\r\ngetrange nope 0 -1\r\n",
+		"+OK\r\n$4\r\nThis\r\n$3\r\ning\r\n$16\r\nThis is a string\r\n$6\r\nstring\r\n$0\r\n\r\n$0\r\n\r\n$0\r\n\r\n")
+	expectReplies(t, conn, reader, "set h \"Hello World\"\r\nsetrange h 6 Redis\r\nget h\r\nsetrange z 6 Redis\r\nget z\r\nsetrange y 0 \"\"\r\nexists y\r\nsetrange h -1 a\r\n",
+		"+OK\r\n:11\r\n$11\r\nHello Redis\r\n:11\r\n$11\r\n\x00\x00\x00\x00\x00\x00Redis\r\n:0\r\n:0\r\n-ERR offset is out of range\r\n")
+	expectReplies(t, conn, reader, "append n 12\r\nappend n 34\r\nget n\r\nstrlen n\r\nstrlen nope\r\nsetrange n 536870911 ab\r\n",
+		":2\r\n:4\r\n$4\r\n1234\r\n:4\r\n:0\r\n-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n")
+}
+
+func TestStrings_AppendCopy(t *testing.T) {
+	// the values share the spare capacity of a backing array
+	shared := append(make([]byte, 0, 16), "base"...)
+	keyspace := newKeyspace(t, map[string]*database.Object{
+		"a": database.NewObject(database.TypeString, shared),
+		"b": database.NewObject(database.TypeString, shared),
+	})
+	conn := serveRedis(t, redis.DefaultRegistry(), keyspace)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "append a 1\r\nappend b 2\r\nget a\r\nget b\r\n",
+		":5\r\n:5\r\n$5\r\nbase1\r\n$5\r\nbase2\r\n")
+	if string(shared[:cap(shared)][4:5]) != "\x00" {
+		t.Errorf("expected the shared backing array untouched, got %q", shared[:5])
+	}
+}
+
+func TestStrings_Incr(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "incr n\r\nincrby n 10\r\ndecr n\r\ndecrby n 5\r\nget n\r\nappend n 0\r\nincr n\r\n",
+		":1\r\n:11\r\n:10\r\n:5\r\n$1\r\n5\r\n:2\r\n:51\r\n")
+	expectReplies(t, conn, reader, "set m 9223372036854775807\r\nincr m\r\ndecrby m -1\r\ndecrby m -9223372036854775808\r\nincrby m x\r\nset m \" 1\"\r\nincr m\r\nset m 01\r\nincr m\r\n",
+		"+OK\r\n-ERR increment or decrement would overflow\r\n-ERR increment or decrement would overflow\r\n"+
+			"-ERR decrement would overflow\r\n-ERR value is not an integer or out of range\r\n"+
+			"+OK\r\n-ERR value is not an integer or out of range\r\n+OK\r\n-ERR value is not an integer or out of range\r\n")
+	expectReplies(t, conn, reader, "set f 10.50\r\nincrbyfloat f 0.1\r\nincrbyfloat f -5\r\nset f 5.0e3\r\nincrbyfloat f 2.0e2\r\nget f\r\n",
+		"+OK\r\n$4\r\n10.6\r\n$3\r\n5.6\r\n+OK\r\n$4\r\n5200\r\n$4\r\n5200\r\n")
+	expectReplies(t, conn, reader, "incrbyfloat f x\r\nincrbyfloat f nan\r\nincrbyfloat f inf\r\nset f abc\r\nincrbyfloat f 1\r\n",
+		"-ERR value is not a valid float\r\n-ERR value is not a valid float\r\n"+
+			"-ERR increment would produce NaN or Infinity\r\n+OK\r\n-ERR value is not a valid float\r\n")
+
+	// the results are computed in long double and formatted as "%.17Lf" without trailing zeros
+	expectReplies(t, conn, reader, "incrbyfloat g 0.1\r\nincrbyfloat g 0.2\r\nincrbyfloat s 1e-20\r\nincrbyfloat s 3e-17\r\nincrbyfloat z -1e-20\r\nincrbyfloat z 1e-99999999\r\n",
+		"$3\r\n0.1\r\n$3\r\n0.3\r\n$1\r\n0\r\n$19\r\n0.00000000000000003\r\n$1\r\n0\r\n$1\r\n0\r\n")
+	expectReplies(t, conn, reader, "incrbyfloat l 1.5e20\r\nincrbyfloat e 1e300\r\nset o 1.7e308\r\nincrbyfloat o 1.7e308\r\nincrbyfloat o 1_0\r\n",
+		"$21\r\n150000000000000000000\r\n$301\r\n1000000000000000000008997324079559193870523944273290747938260082321265646596180935755849152083750497190350372508614274835903592556184672983913096260520748646287327135641843653294084255107606016789726652932370030551382947620994540294772781889620606179267611627097410650567187386105690089424915104006144\r\n"+
+			"+OK\r\n-ERR increment would produce NaN or Infinity\r\n-ERR value is not a valid float\r\n")
+}
+
+func TestStrings_LCS(t *testing.T) {
+	conn := serveRedis(t, redis.DefaultRegistry(), nil)
+	reader := bufio.NewReader(conn)
+
+	expectReplies(t, conn, reader, "mset key1 ohmytext key2 mynewtext\r\nlcs key1 key2\r\nlcs key1 key2 len\r\nlcs key1 nope\r\n",
+		"+OK\r\n$6\r\nmytext\r\n:6\r\n$0\r\n\r\n")
+	expectReplies(t, conn, reader, "lcs key1 key2 idx\r\n",
+		"*4\r\n$7\r\nmatches\r\n*2\r\n"+
+			"*2\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n"+
+			"*2\r\n*2\r\n:2\r\n:3\r\n*2\r\n:0\r\n:1\r\n"+
+			"$3\r\nlen\r\n:6\r\n")
+	expectReplies(t, conn, reader, "lcs key1 key2 idx minmatchlen 4 withmatchlen\r\n",
+		"*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n")
+	expectReplies(t, conn, reader, "lcs key1 key2 len idx\r\nlcs key1 key2 foo\r\nlcs key1 key2 minmatchlen\r\nrpush l a\r\nlcs l key1\r\n",
+		"-ERR If you want both the length and indexes, please just use IDX.\r\n-ERR syntax error\r\n-ERR syntax error\r\n"+
+			":1\r\n-ERR The specified keys must contain string values\r\n")
+}
+
+func TestString_Encoding(t *testing.T) {
+	tests := []struct {
+		value   string
+		integer bool
+	}{
+		{"123", true},
+		{"-9223372036854775808", true},
+		{"0", true},
+		{"-0", false},
+		{"0123", false},
+		{"+1", false},
+		{"9223372036854775808", false},
+		{"1.5", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		obj := database.NewString([]byte(test.value))
+		if _, ok := obj.StringInt(); ok != test.integer {
+			t.Errorf("%q expected integer encoded %v", test.value, test.integer)
+		}
+		if string(obj.StringBytes()) != test.value || obj.StringLen() != len(test.value) {
+			t.Errorf("expected %q, got %q", test.value, obj.StringBytes())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"errors"
+	"math"
+)
+
+// the common error replies
+var (
+	errSyntax     = errors.New("ERR syntax error")
+	errNotInteger = errors.New("ERR value is not an integer or out of range")
+	errNoSuchKey  = errors.New("ERR no such key")
+)
+
+// parseInt parses the decimal integer strictly as redis does, the leading '+', zeros and spaces are not allowed
+func parseInt(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 20 {
+		return 0, false
+	} else if len(b) == 1 && b[0] == '0' {
+		return 0, true
+	}
+
+	neg := b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	if len(b) == 0 || b[0] < '1' || b[0] > '9' {
+		return 0, false
+	}
+
+	var n uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		if n > (math.MaxUint64-uint64(c-'0'))/10 {
+			return 0, false
+		}
+		n = n*10 + uint64(c-'0')
+	}
+
+	if neg {
+		if n > -math.MinInt64 {
+			return 0, false
+		}
+		return -int64(n), true
+	}
+	if n > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(n), true
+}
+
+// stringArgs converts the arguments to strings, e.g. the keys for locking
+func stringArgs(args [][]byte) []string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = string(arg)
+	}
+	return strs
+}